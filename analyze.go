@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+
+	"gitlab.com/meutraa/keyboard-gen/keyboard"
+)
+
+type analysisJSON struct {
+	Name   string          `json:"name"`
+	Layout string          `json:"layout"`
+	Rows   []string        `json:"rows"`
+	Stats  []keyboard.Stat `json:"stats"`
+}
+
+// loadLayout reads a layout file written in the format of keyboard.Grid and
+// scores it against corpus with sc.
+func loadLayout(g *keyboard.Geometry, corpus *keyboard.Corpus, sc *scorer, path string) (*keyboard.Keyboard, error) {
+	text, err := ioutil.ReadFile(path)
+	if nil != err {
+		return nil, err
+	}
+	kb, err := keyboard.ParseLayout(g, string(text))
+	if nil != err {
+		return nil, fmt.Errorf("%v: %w", path, err)
+	}
+	if err := kb.Validate(); nil != err {
+		return nil, fmt.Errorf("%v: %w", path, err)
+	}
+	kb.Corpus = corpus
+	sc.score(kb)
+	return kb, nil
+}
+
+func analyzeCommand(args []string) error {
+	fs := flag.NewFlagSet("analyze", flag.ExitOnError)
+	opts := options{}
+	opts.register(fs)
+	opts.registerProfile(fs)
+	diff := fs.Bool("diff", false, "compare two layouts, showing what changed from the first to the second")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: analyze [flags] layout...\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if err := opts.validate(); nil != err {
+		return err
+	}
+	if err := opts.loadProfile(); nil != err {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return fmt.Errorf("no layout files given")
+	}
+	if *diff && (fs.NArg() != 2 || opts.format != "text") {
+		return fmt.Errorf("-diff needs two layout files and the text format")
+	}
+	g, err := opts.loadGeometry()
+	if nil != err {
+		return err
+	}
+	corpus, err := opts.loadCorpus(g)
+	if nil != err {
+		return err
+	}
+
+	if *diff {
+		old, err := loadLayout(g, corpus, opts.scorer(), fs.Arg(0))
+		if nil != err {
+			return err
+		}
+		kb, err := loadLayout(g, corpus, opts.scorer(), fs.Arg(1))
+		if nil != err {
+			return err
+		}
+		fmt.Print(kb.DiffString(old))
+		return nil
+	}
+
+	analyses := []analysisJSON{}
+	for _, path := range fs.Args() {
+		kb, err := loadLayout(g, corpus, opts.scorer(), path)
+		if nil != err {
+			return err
+		}
+		if opts.format == "json" {
+			analyses = append(analyses, analysisJSON{path, string(kb.Genome()), kb.GridRows(), kb.Stats()})
+			continue
+		}
+		fmt.Printf("\n    %v\n\n", path)
+		fmt.Print(kb, kb.ScoreString())
+	}
+	if opts.format == "json" {
+		data, err := json.MarshalIndent(analyses, "", "  ")
+		if nil != err {
+			return err
+		}
+		fmt.Println(string(data))
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	prand "math/rand"
+
+	"gitlab.com/meutraa/keyboard-gen/keyboard"
+)
+
+const (
+	scheduleGeometric = "geometric"
+	scheduleAdaptive  = "adaptive"
+	scheduleReheat    = "reheat"
+)
+
+// annealConfig controls the temperature of annealLoop. The geometric schedule
+// multiplies the temperature by cooling after every step. The adaptive
+// schedule instead nudges it every window steps, by as much as geometric
+// cooling would over the window, so that the ratio of accepted swaps
+// approaches acceptance. The reheat schedule cools geometrically and
+// resets to the initial temperature after reheat steps without a new best.
+type annealConfig struct {
+	schedule       string
+	temperature    float64
+	minTemperature float64
+	cooling        float64
+	acceptance     float64
+	window         int
+	reheat         int
+}
+
+func (c annealConfig) validate() error {
+	switch c.schedule {
+	case scheduleGeometric, scheduleAdaptive, scheduleReheat:
+	default:
+		return fmt.Errorf("unknown annealing schedule %v", c.schedule)
+	}
+	switch {
+	case c.temperature <= 0:
+		return fmt.Errorf("temperature must be positive")
+	case c.minTemperature <= 0 || c.minTemperature > c.temperature:
+		return fmt.Errorf("min temperature must be positive and at most the temperature")
+	case c.cooling <= 0 || c.cooling >= 1:
+		return fmt.Errorf("cooling must be between 0 and 1")
+	case c.acceptance <= 0 || c.acceptance >= 1:
+		return fmt.Errorf("acceptance must be between 0 and 1")
+	case c.window <= 0:
+		return fmt.Errorf("window must be positive")
+	case c.reheat <= 0:
+		return fmt.Errorf("reheat must be positive")
+	}
+	return nil
+}
+
+func annealLoop(s *search, ws workerState, cfg annealConfig) {
+	src := &splitMix{ws.RNG}
+	r := prand.New(src)
+	sc := s.scorer()
+
+	var kb *keyboard.Keyboard
+	if ws.Layout == "" {
+		kb = s.newKeyboard(sc, r)
+		ws.Gen = 1
+		ws.BestScore = initialScore
+		ws.Temperature = cfg.temperature
+	} else {
+		kb = s.restore(sc, ws.Layout)
+	}
+	bestScore, temperature, gen, sinceLast, accepted, total := ws.BestScore, ws.Temperature, ws.Gen, ws.SinceLast, ws.Accepted, ws.Total
+	bestLayout := ws.Best
+
+	report := func() {
+		ws.RNG = src.state
+		ws.Total, ws.Gen, ws.SinceLast, ws.Accepted = total, gen, sinceLast, accepted
+		ws.BestScore, ws.Temperature = bestScore, temperature
+		ws.Layout, ws.Best = string(kb.Genome()), bestLayout
+		s.progress <- ws
+	}
+
+	for {
+		if s.done(ws.Thread, total) {
+			report()
+			return
+		}
+		if total%progressInterval == 0 {
+			report()
+		}
+		total++
+
+		a := keyboard.Chars[r.Intn(len(keyboard.Chars))]
+		b := keyboard.Chars[r.Intn(len(keyboard.Chars))]
+		delta := sc.swapDelta(kb, a, b)
+		s.evaluated()
+		if delta <= 0 || r.Float64() < math.Exp(-delta/temperature) {
+			kb = sc.applySwap(kb, a, b)
+			accepted++
+		}
+
+		sinceLast++
+		if score := kb.Score(); score < bestScore {
+			best := kb.Copy()
+			best.Gen = gen
+			best.Total = total
+			best.Thread = ws.Thread
+			best.Iteration = sinceLast
+			sinceLast = 0
+			bestScore = score
+			bestLayout = string(best.Genome())
+			s.results <- *best
+		}
+
+		switch cfg.schedule {
+		case scheduleGeometric:
+			temperature *= cfg.cooling
+		case scheduleAdaptive:
+			if total%cfg.window == 0 {
+				step := math.Pow(cfg.cooling, float64(cfg.window))
+				if float64(accepted)/float64(cfg.window) > cfg.acceptance {
+					temperature *= step
+				} else {
+					temperature /= step
+				}
+				accepted = 0
+			}
+		case scheduleReheat:
+			temperature *= cfg.cooling
+			if sinceLast > cfg.reheat {
+				temperature = cfg.temperature
+				gen++
+				sinceLast = 0
+			}
+		}
+		if temperature < cfg.minTemperature {
+			temperature = cfg.minTemperature
+		}
+	}
+}
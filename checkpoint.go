@@ -0,0 +1,167 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	prand "math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+
+	"gitlab.com/meutraa/keyboard-gen/keyboard"
+)
+
+// progressInterval is how many iterations a worker runs between reporting
+// its state for the checkpoint.
+const progressInterval = 1000
+
+// workerState is everything a search worker needs to carry on where it left
+// off. Layouts are stored as genomes. Which fields are used depends on the
+// strategy: climb keeps its best layout in Layout, anneal its current one in
+// Layout and its best in Best, and genetic its whole population.
+type workerState struct {
+	Thread      int      `json:"thread"`
+	RNG         uint64   `json:"rng"`
+	Total       int      `json:"total"`
+	Gen         int      `json:"gen"`
+	Mutations   int      `json:"mutations,omitempty"`
+	SinceLast   int      `json:"sinceLast"`
+	Accepted    int      `json:"accepted,omitempty"`
+	BestScore   float64  `json:"bestScore"`
+	Temperature float64  `json:"temperature,omitempty"`
+	Layout      string   `json:"layout,omitempty"`
+	Best        string   `json:"best,omitempty"`
+	Population  []string `json:"population,omitempty"`
+}
+
+// newWorkers returns the states of n workers starting a search seeded with
+// seed. Each worker gets its own generator so its moves do not depend on how
+// the workers are scheduled.
+func newWorkers(seed int64, n int) []workerState {
+	master := prand.New(prand.NewSource(seed))
+	workers := make([]workerState, n)
+	for i := range workers {
+		workers[i] = workerState{Thread: i, RNG: uint64(master.Int63())}
+	}
+	return workers
+}
+
+type checkpoint struct {
+	Seed      int64             `json:"seed"`
+	Strategy  string            `json:"strategy"`
+	Objective string            `json:"objective,omitempty"`
+	Chars     string            `json:"chars"`
+	Profile   *keyboard.Profile `json:"profile,omitempty"`
+	Best      string            `json:"best,omitempty"`
+	BestScore float64           `json:"bestScore"`
+	Workers   []workerState     `json:"workers"`
+}
+
+func loadCheckpoint(path string) (*checkpoint, error) {
+	data, err := ioutil.ReadFile(path)
+	if nil != err {
+		return nil, err
+	}
+	cp := &checkpoint{}
+	if err := json.Unmarshal(data, cp); nil != err {
+		return nil, err
+	}
+	return cp, nil
+}
+
+// objective returns the objective of the search. Checkpoints from before the
+// objective was recorded were searched with n-grams.
+func (cp *checkpoint) objective() string {
+	if cp.Objective == "" {
+		return objectiveNGrams
+	}
+	return cp.Objective
+}
+
+// conflicts checks that the flags in set, which were given explicitly, agree
+// with the search the checkpoint continues. A resumed search keeps the seed,
+// strategy, objective, workers and profile it was started with, so flags that
+// ask for others are an error rather than ignored. keyboard.ScoreProfile must
+// have been loaded from the -profile flag.
+func (cp *checkpoint) conflicts(set map[string]bool, seed int64, strategy, objective string, workers int) error {
+	switch {
+	case set["seed"] && seed != cp.Seed:
+		return fmt.Errorf("-seed is %d but the checkpoint was started with %d", seed, cp.Seed)
+	case set["strategy"] && strategy != cp.Strategy:
+		return fmt.Errorf("-strategy is %v but the checkpoint was searched with %v", strategy, cp.Strategy)
+	case set["objective"] && objective != cp.objective():
+		return fmt.Errorf("-objective is %v but the checkpoint was searched with %v", objective, cp.objective())
+	case set["workers"] && workers != len(cp.Workers):
+		return fmt.Errorf("-workers is %d but the checkpoint has %d workers", workers, len(cp.Workers))
+	case set["profile"] && nil != cp.Profile && !reflect.DeepEqual(keyboard.ScoreProfile, cp.Profile):
+		return fmt.Errorf("-profile differs from the profile the checkpoint was searched with")
+	}
+	return nil
+}
+
+// validate checks that the checkpoint can be resumed with g and the current
+// keyboard.Chars.
+func (cp *checkpoint) validate(g *keyboard.Geometry, genetic geneticConfig) error {
+	if cp.Chars != string(keyboard.Chars) {
+		return fmt.Errorf("checkpoint places %q but the corpus selected %q", cp.Chars, keyboard.Chars)
+	}
+	layouts := []string{}
+	if cp.Best != "" {
+		layouts = append(layouts, cp.Best)
+	}
+	for _, ws := range cp.Workers {
+		if ws.Layout != "" {
+			layouts = append(layouts, ws.Layout)
+		}
+		if ws.Best != "" {
+			layouts = append(layouts, ws.Best)
+		}
+		if ws.Population != nil && len(ws.Population) != genetic.population {
+			return fmt.Errorf("worker %d has a population of %d but -population is %d", ws.Thread, len(ws.Population), genetic.population)
+		}
+		layouts = append(layouts, ws.Population...)
+	}
+	for _, layout := range layouts {
+		if _, err := keyboard.NewFromGenome(g, []byte(layout)); nil != err {
+			return err
+		}
+	}
+	return nil
+}
+
+// restore scores a layout saved in a checkpoint. The checkpoint must have
+// been validated.
+func (s *search) restore(sc *scorer, layout string) *keyboard.Keyboard {
+	kb, err := keyboard.NewFromGenome(s.geometry, []byte(layout))
+	if nil != err {
+		log.Fatalln("unable to restore layout", err)
+	}
+	kb.Corpus = s.corpus
+	sc.score(kb)
+	return kb
+}
+
+// save writes the checkpoint to a temporary file first so that an interrupted
+// write never replaces a good checkpoint.
+func (cp *checkpoint) save(path string) error {
+	data, err := json.MarshalIndent(cp, "", "  ")
+	if nil != err {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".*")
+	if nil != err {
+		return err
+	}
+	if _, err := tmp.Write(data); nil != err {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); nil != err {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// codeFilter picks the source files of a code corpus and what is kept of
+// them. indent is one of none, tab or keep: none drops the leading whitespace
+// of every line, as editors indent for the programmer, tab replaces it with a
+// single tab and keep leaves it alone. Unless it is keep, runs of whitespace
+// that align code within a line are squeezed to one space too, as formatters
+// insert them.
+type codeFilter struct {
+	extensions    []string
+	stripComments bool
+	stripStrings  bool
+	indent        string
+}
+
+func (f codeFilter) validate() error {
+	switch f.indent {
+	case "none", "tab", "keep":
+		return nil
+	}
+	return fmt.Errorf("unknown indentation %v", f.indent)
+}
+
+// codeSyntax is how comments and strings are written in a language.
+type codeSyntax struct {
+	lineComment  string
+	blockComment [2]string
+	quotes       string
+	// raw strings span lines and have no escapes.
+	raw byte
+}
+
+var cSyntax = codeSyntax{"//", [2]string{"/*", "*/"}, `"'`, 0}
+
+var syntaxes = map[string]codeSyntax{
+	".go":    {"//", [2]string{"/*", "*/"}, `"'`, '`'},
+	".js":    {"//", [2]string{"/*", "*/"}, `"'`, '`'},
+	".ts":    {"//", [2]string{"/*", "*/"}, `"'`, '`'},
+	".c":     cSyntax,
+	".h":     cSyntax,
+	".cc":    cSyntax,
+	".cpp":   cSyntax,
+	".hpp":   cSyntax,
+	".java":  cSyntax,
+	".kt":    cSyntax,
+	".cs":    cSyntax,
+	".rs":    {"//", [2]string{"/*", "*/"}, `"`, 0},
+	".swift": cSyntax,
+	".py":    {"#", [2]string{}, `"'`, 0},
+	".rb":    {"#", [2]string{}, `"'`, 0},
+	".sh":    {"#", [2]string{}, `"'`, 0},
+}
+
+// cleanCode strips the comments and string contents of src as f asks,
+// keeping the quotes, normalizes the indentation and drops what a book cannot
+// hold: carriage returns, characters outside ASCII, trailing whitespace and
+// runs of blank lines.
+func cleanCode(src string, syntax codeSyntax, f codeFilter) string {
+	var out strings.Builder
+	for i := 0; i < len(src); {
+		rest := src[i:]
+		switch {
+		case syntax.lineComment != "" && strings.HasPrefix(rest, syntax.lineComment):
+			end := strings.IndexByte(rest, '\n')
+			if end < 0 {
+				end = len(rest)
+			}
+			if !f.stripComments {
+				out.WriteString(rest[:end])
+			}
+			i += end
+		case syntax.blockComment[0] != "" && strings.HasPrefix(rest, syntax.blockComment[0]):
+			end := strings.Index(rest[len(syntax.blockComment[0]):], syntax.blockComment[1])
+			if end < 0 {
+				end = len(rest)
+			} else {
+				end += len(syntax.blockComment[0]) + len(syntax.blockComment[1])
+			}
+			if !f.stripComments {
+				out.WriteString(rest[:end])
+			}
+			i += end
+		case syntax.raw != 0 && rest[0] == syntax.raw:
+			end := strings.IndexByte(rest[1:], syntax.raw) + 1
+			if end == 0 {
+				end = len(rest)
+			}
+			writeString(&out, rest[:end], f.stripStrings)
+			i += end + 1
+		case strings.IndexByte(syntax.quotes, rest[0]) >= 0:
+			// A string that is not closed on its line, such as a Rust
+			// lifetime, is not a string.
+			end := 1
+			for end < len(rest) && rest[end] != rest[0] && rest[end] != '\n' {
+				if rest[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end < len(rest) && rest[end] == rest[0] {
+				writeString(&out, rest[:end], f.stripStrings)
+				end++
+			} else {
+				out.WriteByte(rest[0])
+				end = 1
+			}
+			i += end
+		default:
+			out.WriteByte(rest[0])
+			i++
+		}
+	}
+
+	var book strings.Builder
+	// A run of blank lines is written as one when the next line is.
+	blank := false
+	for _, line := range strings.Split(out.String(), "\n") {
+		line = strings.Map(func(r rune) rune {
+			if r >= 128 || r == '\r' {
+				return -1
+			}
+			return r
+		}, line)
+		line = strings.TrimRight(line, " \t")
+		if line == "" {
+			blank = book.Len() > 0
+			continue
+		}
+		if f.indent != "keep" {
+			trimmed := strings.Join(strings.Fields(line), " ")
+			if f.indent == "tab" && line[0] != trimmed[0] {
+				trimmed = "\t" + trimmed
+			}
+			line = trimmed
+		}
+		if blank {
+			book.WriteByte('\n')
+			blank = false
+		}
+		book.WriteString(line)
+		book.WriteByte('\n')
+	}
+	return book.String()
+}
+
+// writeString writes a string literal, opened by its first character and
+// closed by the same one, with or without its contents.
+func writeString(out *strings.Builder, literal string, strip bool) {
+	if strip {
+		out.WriteByte(literal[0])
+	} else {
+		out.WriteString(literal)
+	}
+	out.WriteByte(literal[0])
+}
+
+// createCodeBook walks the directory tree at root, skipping hidden
+// directories, and cleans every file with one of the extensions of f into the
+// book.
+func createCodeBook(root string, f codeFilter) (string, error) {
+	var book strings.Builder
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if nil != err {
+			return err
+		}
+		if info.IsDir() {
+			if path != root && strings.HasPrefix(info.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		ext := filepath.Ext(path)
+		if !contains(f.extensions, ext) {
+			return nil
+		}
+		src, err := ioutil.ReadFile(path)
+		if nil != err {
+			return err
+		}
+		book.WriteString(cleanCode(string(src), syntaxes[ext], f))
+		return nil
+	})
+	if nil != err {
+		return "", fmt.Errorf("unable to read %v: %w", root, err)
+	}
+	if book.Len() == 0 {
+		return "", fmt.Errorf("%v has no %v files to build a book from", root, strings.Join(f.extensions, ", "))
+	}
+	return book.String(), nil
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"gitlab.com/meutraa/keyboard-gen/keyboard"
+)
+
+type namedLayout struct {
+	name string
+	kb   *keyboard.Keyboard
+}
+
+func compareCommand(args []string) error {
+	fs := flag.NewFlagSet("compare", flag.ExitOnError)
+	opts := options{}
+	opts.register(fs)
+	opts.registerProfile(fs)
+	references := fs.String("references", strings.Join(keyboard.References(), ","), "comma separated reference layouts to compare")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: compare [flags] [layout...]\n\nThe layout files are compared with the reference layouts.\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if err := opts.validate(); nil != err {
+		return err
+	}
+	if err := opts.loadProfile(); nil != err {
+		return err
+	}
+	g, err := opts.loadGeometry()
+	if nil != err {
+		return err
+	}
+	corpus, err := opts.loadCorpus(g)
+	if nil != err {
+		return err
+	}
+
+	layouts := []namedLayout{}
+	if *references != "" {
+		for _, name := range strings.Split(*references, ",") {
+			kb, err := keyboard.Reference(g, name)
+			if nil != err {
+				return err
+			}
+			kb.Corpus = corpus
+			opts.scorer().score(kb)
+			layouts = append(layouts, namedLayout{name, kb})
+		}
+	}
+	for _, path := range fs.Args() {
+		kb, err := loadLayout(g, corpus, opts.scorer(), path)
+		if nil != err {
+			return err
+		}
+		layouts = append(layouts, namedLayout{path, kb})
+	}
+	if len(layouts) == 0 {
+		return fmt.Errorf("no layouts to compare")
+	}
+	sort.SliceStable(layouts, func(i, j int) bool {
+		return layouts[i].kb.Score() < layouts[j].kb.Score()
+	})
+
+	if opts.format == "json" {
+		ranked := make([]analysisJSON, len(layouts))
+		for i, l := range layouts {
+			ranked[i] = analysisJSON{l.name, string(l.kb.Genome()), l.kb.GridRows(), l.kb.Stats()}
+		}
+		data, err := json.MarshalIndent(ranked, "", "  ")
+		if nil != err {
+			return err
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+
+	// One column per layout, best first, and one row per metric.
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprint(w, "Rank\t")
+	for i := range layouts {
+		fmt.Fprintf(w, "%d\t", i+1)
+	}
+	fmt.Fprint(w, "\nLayout\t")
+	for _, l := range layouts {
+		fmt.Fprintf(w, "%v\t", l.name)
+	}
+	fmt.Fprintln(w)
+	stats := make([][]keyboard.Stat, len(layouts))
+	for i, l := range layouts {
+		stats[i] = l.kb.Stats()
+	}
+	for k, stat := range stats[0] {
+		fmt.Fprintf(w, "%v\t", stat.Name)
+		for i := range layouts {
+			fmt.Fprintf(w, "%v\t", keyboard.FormatStat(stats[i][k].Value))
+		}
+		fmt.Fprintln(w)
+	}
+	return w.Flush()
+}
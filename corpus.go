@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"strconv"
+
+	"gitlab.com/meutraa/keyboard-gen/keyboard"
+)
+
+type corpusJSON struct {
+	Length   int64            `json:"length"`
+	Chars    string           `json:"chars"`
+	Unigrams []keyboard.NGram `json:"unigrams"`
+	Bigrams  []keyboard.NGram `json:"bigrams"`
+	Trigrams []keyboard.NGram `json:"trigrams"`
+}
+
+func corpusCommand(args []string) error {
+	fs := flag.NewFlagSet("corpus", flag.ExitOnError)
+	opts := options{}
+	opts.register(fs)
+	top := fs.Int("top", 20, "number of bigrams and trigrams to show")
+	fs.Parse(args)
+
+	if err := opts.validate(); nil != err {
+		return err
+	}
+	g, err := opts.loadGeometry()
+	if nil != err {
+		return err
+	}
+	corpus, err := opts.loadCorpus(g)
+	if nil != err {
+		return err
+	}
+
+	stats := corpusJSON{
+		Length:   corpus.Length,
+		Chars:    string(keyboard.Chars),
+		Unigrams: corpus.Top(1, len(keyboard.Chars)),
+		Bigrams:  corpus.Top(2, *top),
+		Trigrams: corpus.Top(3, *top),
+	}
+	if opts.format == "json" {
+		data, err := json.MarshalIndent(stats, "", "  ")
+		if nil != err {
+			return err
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+
+	fmt.Printf("Length: %v\nChars:  %q\n", stats.Length, stats.Chars)
+	for _, section := range []struct {
+		name   string
+		ngrams []keyboard.NGram
+	}{
+		{"Unigrams", stats.Unigrams},
+		{"Bigrams", stats.Bigrams},
+		{"Trigrams", stats.Trigrams},
+	} {
+		fmt.Printf("\n%v:\n", section.name)
+		for _, n := range section.ngrams {
+			fmt.Printf("    %-8v %10v %6.2f%%\n", strconv.Quote(n.Text), n.Count, 100*float64(n.Count)/float64(stats.Length))
+		}
+	}
+	return nil
+}
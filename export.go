@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+
+	"gitlab.com/meutraa/keyboard-gen/keyboard"
+)
+
+func exportCommand(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	geometryPath := fs.String("geometry", "", "path to a JSON keyboard geometry, defaults to the 4x12 ortholinear board")
+	format := fs.String("format", "text", "output format, text or json")
+	checkpointPath := fs.String("checkpoint", "", "checkpoint written by optimize")
+	worker := fs.Int("worker", -1, "export the layout of this worker instead of the best layout")
+	fs.Parse(args)
+
+	opts := options{geometry: *geometryPath, format: *format}
+	if err := opts.validate(); nil != err {
+		return err
+	}
+	if *checkpointPath == "" {
+		return fmt.Errorf("-checkpoint is required")
+	}
+	cp, err := loadCheckpoint(*checkpointPath)
+	if nil != err {
+		return fmt.Errorf("unable to load checkpoint: %w", err)
+	}
+	g, err := opts.loadGeometry()
+	if nil != err {
+		return err
+	}
+
+	layout, score := cp.Best, cp.BestScore
+	if *worker >= 0 {
+		if *worker >= len(cp.Workers) {
+			return fmt.Errorf("the checkpoint has %d workers", len(cp.Workers))
+		}
+		ws := cp.Workers[*worker]
+		layout, score = ws.Layout, ws.BestScore
+		if ws.Population != nil {
+			// Genetic populations are saved sorted by score.
+			layout = ws.Population[0]
+		}
+	}
+	if layout == "" {
+		return fmt.Errorf("the checkpoint has no layout to export")
+	}
+	kb, err := keyboard.NewFromGenome(g, []byte(layout))
+	if nil != err {
+		return err
+	}
+
+	if opts.format == "json" {
+		out := newLayoutJSON(kb, score)
+		out.Thread = *worker
+		data, err := json.MarshalIndent(out, "", "  ")
+		if nil != err {
+			return err
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+	fmt.Print(kb.Grid())
+	return nil
+}
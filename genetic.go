@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	prand "math/rand"
+	"sort"
+
+	"gitlab.com/meutraa/keyboard-gen/keyboard"
+)
+
+var crossovers = map[string]func(r *prand.Rand, a, b *keyboard.Keyboard) *keyboard.Keyboard{
+	"pmx": keyboard.PartiallyMappedCrossover,
+	"cx":  keyboard.CycleCrossover,
+	"ox":  keyboard.OrderCrossover,
+}
+
+// geneticConfig controls geneticLoop. Each generation keeps the elite best
+// layouts and breeds the rest of the population from parents picked by
+// tournaments of the given size. A child is mutated with the given
+// probability. crossover is one of the keys of crossovers, or all to pick one
+// at random for every child.
+type geneticConfig struct {
+	population int
+	elite      int
+	tournament int
+	mutation   float64
+	crossover  string
+}
+
+func (c geneticConfig) validate() error {
+	if _, ok := crossovers[c.crossover]; !ok && c.crossover != "all" {
+		return fmt.Errorf("unknown crossover %v", c.crossover)
+	}
+	switch {
+	case c.population < 2:
+		return fmt.Errorf("population must be at least 2")
+	case c.elite < 0 || c.elite >= c.population:
+		return fmt.Errorf("elite must be between 0 and the population size")
+	case c.tournament < 1:
+		return fmt.Errorf("tournament must be at least 1")
+	case c.mutation < 0 || c.mutation >= 1:
+		// A child is mutated again for as long as a draw is below mutation,
+		// which never ends with 1.
+		return fmt.Errorf("mutation must be at least 0 and below 1")
+	}
+	return nil
+}
+
+func (c geneticConfig) breed(r *prand.Rand, a, b *keyboard.Keyboard) *keyboard.Keyboard {
+	if c.crossover != "all" {
+		return crossovers[c.crossover](r, a, b)
+	}
+	switch r.Intn(3) {
+	case 0:
+		return keyboard.PartiallyMappedCrossover(r, a, b)
+	case 1:
+		return keyboard.CycleCrossover(r, a, b)
+	default:
+		return keyboard.OrderCrossover(r, a, b)
+	}
+}
+
+func geneticLoop(s *search, ws workerState, cfg geneticConfig) {
+	src := &splitMix{ws.RNG}
+	r := prand.New(src)
+	sc := s.scorer()
+
+	population := make([]*keyboard.Keyboard, cfg.population)
+	if ws.Population == nil {
+		for i := range population {
+			population[i] = s.newKeyboard(sc, r)
+		}
+		ws.Gen = 1
+		ws.BestScore = initialScore
+	} else {
+		population = population[:0]
+		for _, layout := range ws.Population {
+			population = append(population, s.restore(sc, layout))
+		}
+	}
+
+	// Tournament selection of a parent from the population.
+	pick := func() *keyboard.Keyboard {
+		best := population[r.Intn(len(population))]
+		for i := 1; i < cfg.tournament; i++ {
+			if kb := population[r.Intn(len(population))]; kb.Score() < best.Score() {
+				best = kb
+			}
+		}
+		return best
+	}
+
+	bestScore, total := ws.BestScore, ws.Total
+	for gen := ws.Gen; ; gen++ {
+		sort.Slice(population, func(i, j int) bool {
+			return population[i].Score() < population[j].Score()
+		})
+
+		ws.RNG = src.state
+		ws.Total, ws.Gen, ws.BestScore = total, gen, bestScore
+		ws.Population = make([]string, len(population))
+		for i, kb := range population {
+			ws.Population[i] = string(kb.Genome())
+		}
+		s.progress <- ws
+
+		if score := population[0].Score(); score < bestScore {
+			best := population[0].Copy()
+			best.Gen = gen
+			best.Total = total
+			best.Thread = ws.Thread
+			bestScore = score
+			s.results <- *best
+		}
+
+		// Generations are never cut short so the checkpoint always holds a
+		// whole population.
+		if s.done(ws.Thread, total) {
+			return
+		}
+
+		next := make([]*keyboard.Keyboard, 0, cfg.population)
+		next = append(next, population[:cfg.elite]...)
+		for len(next) < cfg.population {
+			child := cfg.breed(r, pick(), pick())
+			mutations := 0
+			for r.Float64() < cfg.mutation {
+				child.Mutate(r)
+				mutations++
+			}
+			sc.score(child)
+			s.evaluated()
+			child.Mutation = mutations
+			next = append(next, child)
+			total++
+		}
+		population = next
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+
+	"gitlab.com/meutraa/keyboard-gen/keyboard"
+)
+
+type heatmapJSON struct {
+	Name string             `json:"name"`
+	Keys []keyboard.KeyHeat `json:"keys"`
+}
+
+func heatmapCommand(args []string) error {
+	fs := flag.NewFlagSet("heatmap", flag.ExitOnError)
+	opts := options{}
+	opts.register(fs)
+	fs.Lookup("format").Usage = "output format, text, csv or json"
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: heatmap [flags] layout...\n\nEach layout is a layout file or the name of a reference layout.\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if err := opts.validate("csv"); nil != err {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return fmt.Errorf("no layouts given")
+	}
+	g, err := opts.loadGeometry()
+	if nil != err {
+		return err
+	}
+	corpus, err := opts.loadCorpus(g)
+	if nil != err {
+		return err
+	}
+
+	maps := []heatmapJSON{}
+	w := csv.NewWriter(os.Stdout)
+	if opts.format == "csv" {
+		w.Write([]string{"layout", "row", "col", "char", "presses", "frequency", "same_finger", "effort"})
+	}
+	for _, name := range fs.Args() {
+		kb, err := keyboard.Reference(g, name)
+		if nil != err {
+			kb, err = loadLayout(g, corpus, opts.scorer(), name)
+			if nil != err {
+				return err
+			}
+		}
+		kb.Corpus = corpus
+		switch opts.format {
+		case "json":
+			maps = append(maps, heatmapJSON{name, kb.Heatmap()})
+		case "csv":
+			for _, h := range kb.Heatmap() {
+				w.Write([]string{
+					name,
+					strconv.Itoa(h.Row),
+					strconv.Itoa(h.Col),
+					h.Char,
+					strconv.FormatInt(h.Presses, 10),
+					strconv.FormatFloat(h.Frequency, 'f', -1, 64),
+					strconv.FormatFloat(h.SameFinger, 'f', -1, 64),
+					strconv.FormatFloat(h.Effort, 'f', -1, 64),
+				})
+			}
+		default:
+			fmt.Printf("\n    %v\n\n", name)
+			fmt.Print(kb, kb.HeatmapString())
+		}
+	}
+	switch opts.format {
+	case "json":
+		data, err := json.MarshalIndent(maps, "", "  ")
+		if nil != err {
+			return err
+		}
+		fmt.Println(string(data))
+	case "csv":
+		w.Flush()
+		return w.Error()
+	}
+	return nil
+}
@@ -0,0 +1,329 @@
+package keyboard
+
+import "math"
+
+// The metrics the optimizer was written with. Rolls between two keys of
+// effort 2 or less are comfy.
+
+func init() {
+	Register(NewMetric(WeightRepeatedPresses, "Repeated Finger 0 Gap", 2, sameFinger))
+	Register(NewMetric(WeightRepeatFinger1Gap, "Repeated Finger 1 Gap", 3, repeatFinger1Gap))
+	Register(NewMetric(WeightEffort, "Comfortableness", 1, effortOf))
+	Register(NewMetric(WeightComfyInward, "Comfy Inward Rolls", 2, roll(inroll, true)))
+	Register(NewMetric(WeightInward, "Other Inward Rolls", 2, roll(inroll, false)))
+	Register(NewMetric(WeightComfyOutward, "Comfy Outward Rolls", 2, roll(outroll, true)))
+	Register(NewMetric(WeightOutward, "Other Outward Rolls", 2, roll(outroll, false)))
+	Register(NewSequenceMetric(WeightHandOverUse, "Hand Overuse", 3, handOverUse, func() SequenceState { return &rolls{} }))
+	Register(NewMetric(WeightRowjump, "Rowjumps", 2, rowjumps))
+	Register(NewMetric(WeightLateralStretch, "Lateral Stretches", 2, lateralStretch))
+	Register(NewMetric(WeightFullScissor, "Full Scissors", 2, scissor(true)))
+	Register(NewMetric(WeightHalfScissor, "Half Scissors", 2, scissor(false)))
+	Register(NewSequenceMetric(WeightDistance, "Distance", 3, distance, func() SequenceState { return &fingerPositions{} }))
+	Register(NewMetric(WeightAlternation, "Alternation", 3, trigramClass(alternate)))
+	Register(NewMetric(WeightTrigramInroll, "Trigram Inrolls", 3, trigramClass(trigramInroll)))
+	Register(NewMetric(WeightTrigramOutroll, "Trigram Outrolls", 3, trigramClass(trigramOutroll)))
+	Register(NewMetric(WeightOneHandRoll, "One Hand Rolls", 3, trigramClass(oneHandRoll)))
+	Register(NewMetric(WeightRedirect, "Redirects", 3, trigramClass(redirect)))
+	Register(NewMetric(WeightBadRedirect, "Bad Redirects", 3, trigramClass(badRedirect)))
+	Register(sameFingerSkipgram{})
+	RegisterFactor(handUsage{})
+	RegisterFactor(fingerUsage{})
+}
+
+func sameFinger(g *Geometry, k [3]KeyPosition) float64 {
+	if g.absFinger[k[0].i][k[0].j] == g.absFinger[k[1].i][k[1].j] {
+		return 1
+	}
+	return 0
+}
+
+func repeatFinger1Gap(g *Geometry, k [3]KeyPosition) float64 {
+	if g.absFinger[k[0].i][k[0].j] == g.absFinger[k[2].i][k[2].j] {
+		return 1
+	}
+	return 0
+}
+
+func effortOf(g *Geometry, k [3]KeyPosition) float64 {
+	return float64(g.effort[k[0].i][k[0].j])
+}
+
+func roll(direction int, comfy bool) func(g *Geometry, k [3]KeyPosition) float64 {
+	return func(g *Geometry, k [3]KeyPosition) float64 {
+		a, b := k[0], k[1]
+		if g.transition(a, b) == direction && (g.effort[a.i][a.j] <= 2 && g.effort[b.i][b.j] <= 2) == comfy {
+			return 1
+		}
+		return 0
+	}
+}
+
+func rowjumps(g *Geometry, k [3]KeyPosition) float64 {
+	if g.transition(k[0], k[1]) == rowjump {
+		return 1
+	}
+	return 0
+}
+
+// lateralStretch counts bigrams typed by neighbouring fingers of one hand
+// where the index finger reaches into the inner column or the pinky into the
+// outer column.
+func lateralStretch(g *Geometry, k [3]KeyPosition) float64 {
+	a, b := k[0], k[1]
+	if g.hand[a.i][a.j] != g.hand[b.i][b.j] {
+		return 0
+	}
+	fa, fb := g.handFinger[a.i][a.j], g.handFinger[b.i][b.j]
+	if fa == 4 || fb == 4 || (fa-fb != 1 && fb-fa != 1) {
+		return 0
+	}
+	if stretched(g, a) || stretched(g, b) {
+		return 1
+	}
+	return 0
+}
+
+// stretched reports whether p takes the index finger to the inner column or
+// the pinky to the outer column.
+func stretched(g *Geometry, p KeyPosition) bool {
+	switch g.handFinger[p.i][p.j] {
+	case 3:
+		return g.handColumn[p.i][p.j] == 5
+	case 0:
+		return g.handColumn[p.i][p.j] == 0
+	}
+	return false
+}
+
+// scissorWeights weighs a scissor by the lower absolute finger of the pair:
+// pinky and ring scissors hurt the most, middle and index the least.
+var scissorWeights = [10]float64{1.5, 1.25, 1, 0, 0, 0, 1, 1.25, 1.5, 0}
+
+// fingerLength orders the fingers of a hand, by hand finger, from shortest to
+// longest.
+var fingerLength = [4]int{0, 1, 2, 1}
+
+// scissor returns a metric of bigrams typed by neighbouring fingers of one
+// hand on different rows. A full scissor spans two rows or more. A half
+// scissor spans one row with the shorter finger on the upper row.
+func scissor(full bool) func(g *Geometry, k [3]KeyPosition) float64 {
+	return func(g *Geometry, k [3]KeyPosition) float64 {
+		a, b := k[0], k[1]
+		fa, fb := g.absFinger[a.i][a.j], g.absFinger[b.i][b.j]
+		if fa > fb {
+			a, b, fa, fb = b, a, fb, fa
+		}
+		if fb-fa != 1 || g.hand[a.i][a.j] != g.hand[b.i][b.j] || g.handFinger[a.i][a.j] == 4 || g.handFinger[b.i][b.j] == 4 {
+			return 0
+		}
+		rows := b.i - a.i
+		if rows < 0 {
+			rows = -rows
+		}
+		switch {
+		case full && rows >= 2:
+			return scissorWeights[fa]
+		case !full && rows == 1:
+			upper, lower := a, b
+			if upper.i > lower.i {
+				upper, lower = lower, upper
+			}
+			if fingerLength[g.handFinger[upper.i][upper.j]] < fingerLength[g.handFinger[lower.i][lower.j]] {
+				return scissorWeights[fa]
+			}
+		}
+		return 0
+	}
+}
+
+// handOverUse counts a roll followed by any other same hand movement than a
+// roll in the same direction. From trigrams it only sees the movement right
+// before, while rolls remembers the last one however many presses of the
+// other hand came since.
+func handOverUse(g *Geometry, k [3]KeyPosition) float64 {
+	z, a, b := k[0], k[1], k[2]
+	switch g.transition(a, b) {
+	case crossHand:
+		return 0
+	case inroll:
+		if g.transition(z, a) == outroll {
+			return 1
+		}
+	case outroll:
+		if g.transition(z, a) == inroll {
+			return 1
+		}
+	default:
+		if t := g.transition(z, a); t == inroll || t == outroll {
+			return 1
+		}
+	}
+	return 0
+}
+
+// rolls is the state of handOverUse while walking a book.
+type rolls struct {
+	inroll, outroll bool
+}
+
+func (s *rolls) Reset(g *Geometry) {
+	*s = rolls{}
+}
+
+func (s *rolls) Press(g *Geometry, a, b KeyPosition, acc []float64) {
+	switch g.transition(a, b) {
+	case inroll:
+		if s.outroll {
+			acc[0]++
+		}
+		s.inroll, s.outroll = true, false
+	case outroll:
+		if s.inroll {
+			acc[0]++
+		}
+		s.inroll, s.outroll = false, true
+	case rowjump, sameHand:
+		if s.inroll || s.outroll {
+			acc[0]++
+		}
+		s.inroll, s.outroll = false, false
+	}
+}
+
+// distance is how far the finger travels to the last key of a trigram. The
+// finger is assumed to start from its home key unless it pressed one of the
+// two keys before, while fingerPositions knows where it last pressed.
+func distance(g *Geometry, k [3]KeyPosition) float64 {
+	z, a, b := k[0], k[1], k[2]
+	afb := g.absFinger[b.i][b.j]
+	switch afb {
+	case g.absFinger[a.i][a.j]:
+		return g.distance(a, b)
+	case g.absFinger[z.i][z.j]:
+		return g.distance(z, b)
+	default:
+		return g.distance(g.home[afb], b)
+	}
+}
+
+// fingerPositions is the state of distance while walking a book: the key
+// each finger last pressed, starting from its home key.
+type fingerPositions struct {
+	fingers [10]KeyPosition
+}
+
+func (s *fingerPositions) Reset(g *Geometry) {
+	s.fingers = g.home
+}
+
+func (s *fingerPositions) Press(g *Geometry, a, b KeyPosition, acc []float64) {
+	f := g.absFinger[b.i][b.j]
+	acc[0] += g.distance(b, s.fingers[f])
+	s.fingers[f] = b
+}
+
+// sameFingerSkipgram sums how far a finger travels between two keys it
+// presses with 1 to maxGap other keys in between. The sums are kept per gap
+// and finger, at (gap-1)*10+finger, and weighed by
+// ScoreProfile.SkipgramDecay^(gap-1) up to ScoreProfile.SkipgramGaps. A gap of
+// one key is observed in trigrams, so that when the middle key is typed by the
+// other hand it is summed apart, at maxGap*10+finger, and weighed by
+// ScoreProfile.SkipgramOtherHand too. Longer gaps come from the skipgram
+// tables, which do not keep the keys in between, and are counted whichever
+// hand types those.
+type sameFingerSkipgram struct{}
+
+func (sameFingerSkipgram) Name() string      { return WeightSameFingerSkipgram }
+func (sameFingerSkipgram) Label() string     { return "Same Finger Skipgrams" }
+func (sameFingerSkipgram) Order() int        { return 3 }
+func (sameFingerSkipgram) Accumulators() int { return (maxGap + 1) * 10 }
+
+func (sameFingerSkipgram) Observe(g *Geometry, keys [3]KeyPosition, count int64, acc []float64) {
+	z, a, b := keys[0], keys[1], keys[2]
+	f := g.absFinger[z.i][z.j]
+	if f != g.absFinger[b.i][b.j] {
+		return
+	}
+	if g.hand[a.i][a.j] != g.hand[b.i][b.j] {
+		f += maxGap * 10
+	}
+	acc[f] += g.distance(z, b) * float64(count)
+}
+
+func (sameFingerSkipgram) ObserveSkipgram(g *Geometry, a, b KeyPosition, gap int, count int64, acc []float64) {
+	f := g.absFinger[a.i][a.j]
+	if gap == 1 || f != g.absFinger[b.i][b.j] {
+		return
+	}
+	acc[(gap-1)*10+f] += g.distance(a, b) * float64(count)
+}
+
+func (m sameFingerSkipgram) Value(acc []float64, length int64) float64 {
+	value := 0.0
+	for _, v := range m.fingers(acc) {
+		value += v
+	}
+	return value
+}
+
+// fingers returns the weighed skipgram distance of each finger.
+func (sameFingerSkipgram) fingers(acc []float64) (fingers [10]float64) {
+	if ScoreProfile.SkipgramGaps > 0 {
+		for f := range fingers {
+			fingers[f] = acc[maxGap*10+f] * ScoreProfile.SkipgramOtherHand
+		}
+	}
+	weight := 1.0
+	for gap := 1; gap <= ScoreProfile.SkipgramGaps; gap++ {
+		for f := range fingers {
+			fingers[f] += acc[(gap-1)*10+f] * weight
+		}
+		weight *= ScoreProfile.SkipgramDecay
+	}
+	return
+}
+
+// fingerUsage counts the presses of each finger. Its value is the summed
+// difference between each finger's share of the presses and its target.
+type fingerUsage struct{}
+
+func (fingerUsage) Name() string      { return WeightFingerInequality }
+func (fingerUsage) Label() string     { return "Finger Inequality" }
+func (fingerUsage) Order() int        { return 1 }
+func (fingerUsage) Accumulators() int { return 10 }
+
+func (fingerUsage) Observe(g *Geometry, keys [3]KeyPosition, count int64, acc []float64) {
+	acc[g.absFinger[keys[0].i][keys[0].j]] += float64(count)
+}
+
+func (fingerUsage) Value(acc []float64, length int64) float64 {
+	if length == 0 {
+		return 0
+	}
+	inequality := 0.0
+	for f, count := range acc {
+		inequality += math.Abs(targetFingerUsage[f] - count/float64(length))
+	}
+	return inequality
+}
+
+// handUsage counts the presses of each hand, taking fingers 0 to 4 as the
+// left hand. Its value is the summed difference between each hand's share of
+// the presses and a half.
+type handUsage struct{}
+
+func (handUsage) Name() string      { return WeightHandInequality }
+func (handUsage) Label() string     { return "Hand Inequality" }
+func (handUsage) Order() int        { return 1 }
+func (handUsage) Accumulators() int { return 2 }
+
+func (handUsage) Observe(g *Geometry, keys [3]KeyPosition, count int64, acc []float64) {
+	acc[g.absFinger[keys[0].i][keys[0].j]/5] += float64(count)
+}
+
+func (handUsage) Value(acc []float64, length int64) float64 {
+	if length == 0 {
+		return 0
+	}
+	return math.Abs(0.5-acc[0]/float64(length)) + math.Abs(0.5-acc[1]/float64(length))
+}
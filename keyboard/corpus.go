@@ -0,0 +1,267 @@
+package keyboard
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+type ngram struct {
+	a, b, c byte
+	count   int64
+}
+
+// maxGap is the most characters between the two of a skipgram.
+const maxGap = 3
+
+// Corpus is a book compiled into unigram, bigram, trigram and skipgram counts
+// so that a layout can be scored without walking the book. N-grams are
+// counted as if the book were preceded by spaces, which is where FillScore
+// starts its walk. skipgrams[gap] counts the pairs of characters with gap
+// characters between them.
+type Corpus struct {
+	Length    int64
+	unigrams  []ngram
+	bigrams   []ngram
+	trigrams  []ngram
+	skipgrams [maxGap + 1][]ngram
+	counts    [128]int64
+	// Indices of the n-grams each character appears in, used to rescore a
+	// swap.
+	bigramsByChar   [128][]int32
+	trigramsByChar  [128][]int32
+	skipgramsByChar [maxGap + 1][128][]int32
+}
+
+// ngramCounts are the n-gram counts a Corpus is built from, keyed by their
+// characters in base 128.
+type ngramCounts struct {
+	unigrams  [128]int64
+	bigrams   []int64
+	trigrams  map[int]int64
+	skipgrams [maxGap + 1][]int64
+}
+
+func newNGramCounts() *ngramCounts {
+	n := &ngramCounts{bigrams: make([]int64, 128*128), trigrams: map[int]int64{}}
+	for gap := 1; gap <= maxGap; gap++ {
+		n.skipgrams[gap] = make([]int64, 128*128)
+	}
+	return n
+}
+
+func NewCorpus(book string) (*Corpus, error) {
+	counts := newNGramCounts()
+	// history[k] is the character k+1 before the current one.
+	history := [maxGap + 1]byte{' ', ' ', ' ', ' '}
+	for i := 0; i < len(book); i++ {
+		b := book[i]
+		if b >= 128 {
+			return nil, fmt.Errorf("book contains the non-ASCII byte %#x at offset %d", b, i)
+		}
+		z, a := history[1], history[0]
+		counts.unigrams[b]++
+		counts.bigrams[int(a)<<7|int(b)]++
+		counts.trigrams[int(z)<<14|int(a)<<7|int(b)]++
+		for gap := 1; gap <= maxGap; gap++ {
+			counts.skipgrams[gap][int(history[gap])<<7|int(b)]++
+		}
+		copy(history[1:], history[:maxGap])
+		history[0] = b
+	}
+	return newCorpus(counts), nil
+}
+
+// BlendCorpora combines corpora so that each makes up the given share of the
+// result, however long it is. The weights are normalized to add up to 1. The
+// counts of each corpus are scaled by its share over its length, times a
+// common length chosen so that no count is scaled below 1, and rounded.
+func BlendCorpora(corpora []*Corpus, weights []float64) (*Corpus, error) {
+	if len(corpora) != len(weights) {
+		return nil, fmt.Errorf("%d corpora but %d weights", len(corpora), len(weights))
+	}
+	total := 0.0
+	for i, w := range weights {
+		if w <= 0 || math.IsInf(w, 0) || math.IsNaN(w) {
+			return nil, fmt.Errorf("corpus %d has the weight %v, want a positive number", i+1, w)
+		}
+		if corpora[i].Length == 0 {
+			return nil, fmt.Errorf("corpus %d is empty", i+1)
+		}
+		total += w
+	}
+	length := 0.0
+	for i, c := range corpora {
+		length = math.Max(length, float64(c.Length)*total/weights[i])
+	}
+
+	counts := newNGramCounts()
+	for i, c := range corpora {
+		scale := weights[i] / total * length / float64(c.Length)
+		scaled := func(n ngram) int64 {
+			return int64(math.Round(float64(n.count) * scale))
+		}
+		for _, n := range c.unigrams {
+			counts.unigrams[n.a] += scaled(n)
+		}
+		for _, n := range c.bigrams {
+			counts.bigrams[int(n.a)<<7|int(n.b)] += scaled(n)
+		}
+		for _, n := range c.trigrams {
+			counts.trigrams[int(n.a)<<14|int(n.b)<<7|int(n.c)] += scaled(n)
+		}
+		for gap := 1; gap <= maxGap; gap++ {
+			for _, n := range c.skipgrams[gap] {
+				counts.skipgrams[gap][int(n.a)<<7|int(n.b)] += scaled(n)
+			}
+		}
+	}
+	return newCorpus(counts), nil
+}
+
+func newCorpus(counts *ngramCounts) *Corpus {
+	c := &Corpus{counts: counts.unigrams}
+	for b, count := range counts.unigrams {
+		if count != 0 {
+			c.Length += count
+			c.unigrams = append(c.unigrams, ngram{a: byte(b), count: count})
+		}
+	}
+	for k, count := range counts.bigrams {
+		if count != 0 {
+			c.bigrams = append(c.bigrams, ngram{a: byte(k >> 7), b: byte(k & 127), count: count})
+		}
+	}
+	for gap := 1; gap <= maxGap; gap++ {
+		for k, count := range counts.skipgrams[gap] {
+			if count != 0 {
+				c.skipgrams[gap] = append(c.skipgrams[gap], ngram{a: byte(k >> 7), b: byte(k & 127), count: count})
+			}
+		}
+	}
+	trigrams := counts.trigrams
+	keys := make([]int, 0, len(trigrams))
+	for k := range trigrams {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+	for _, k := range keys {
+		if trigrams[k] != 0 {
+			c.trigrams = append(c.trigrams, ngram{byte(k >> 14), byte(k >> 7 & 127), byte(k & 127), trigrams[k]})
+		}
+	}
+
+	c.bigramsByChar = pairsByChar(c.bigrams)
+	for gap := 1; gap <= maxGap; gap++ {
+		c.skipgramsByChar[gap] = pairsByChar(c.skipgrams[gap])
+	}
+	for i, n := range c.trigrams {
+		c.trigramsByChar[n.a] = append(c.trigramsByChar[n.a], int32(i))
+		if n.b != n.a {
+			c.trigramsByChar[n.b] = append(c.trigramsByChar[n.b], int32(i))
+		}
+		if n.c != n.a && n.c != n.b {
+			c.trigramsByChar[n.c] = append(c.trigramsByChar[n.c], int32(i))
+		}
+	}
+	return c
+}
+
+func pairsByChar(pairs []ngram) [128][]int32 {
+	byChar := [128][]int32{}
+	for i, n := range pairs {
+		byChar[n.a] = append(byChar[n.a], int32(i))
+		if n.b != n.a {
+			byChar[n.b] = append(byChar[n.b], int32(i))
+		}
+	}
+	return byChar
+}
+
+// NGram is a sequence of characters and how often it occurs in a corpus.
+type NGram struct {
+	Text  string
+	Count int64
+}
+
+// Top returns the n most frequent n-grams of the given order, 1 to 3, most
+// frequent first.
+func (c *Corpus) Top(order, n int) []NGram {
+	var table []ngram
+	switch order {
+	case 1:
+		table = c.unigrams
+	case 2:
+		table = c.bigrams
+	case 3:
+		table = c.trigrams
+	}
+	top := make([]NGram, len(table))
+	for i, g := range table {
+		top[i] = NGram{string([]byte{g.a, g.b, g.c}[:order]), g.count}
+	}
+	sort.Slice(top, func(i, j int) bool {
+		if top[i].Count == top[j].Count {
+			return top[i].Text < top[j].Text
+		}
+		return top[i].Count > top[j].Count
+	})
+	if n < len(top) {
+		top = top[:n]
+	}
+	return top
+}
+
+const (
+	crossHand = iota
+	inroll
+	outroll
+	rowjump
+	sameHand
+)
+
+func (g *Geometry) transition(a, b KeyPosition) int {
+	return int(g.transitions[g.index(a)*g.rows*g.cols+g.index(b)])
+}
+
+// classify classifies the movement from a to b between two keys of one hand
+// into rolls towards or away from the thumb, jumps over a row, or neither.
+func (g *Geometry) classify(a, b KeyPosition) int {
+	ai, aj, bi, bj := a.i, a.j, b.i, b.j
+	switch {
+	case g.hand[ai][aj] != g.hand[bi][bj]:
+		return crossHand
+	case g.handFinger[ai][aj] < g.handFinger[bi][bj] && g.handColumn[ai][aj] < g.handColumn[bi][bj]:
+		return inroll
+	case g.handFinger[ai][aj] > g.handFinger[bi][bj] && g.handColumn[ai][aj] > g.handColumn[bi][bj]:
+		return outroll
+	case g.handFinger[ai][aj] != 4 && g.handFinger[bi][bj] != 4 && (bi-ai > 1 || ai-bi > 1):
+		return rowjump
+	default:
+		return sameHand
+	}
+}
+
+// FillScoreNGrams feeds the n-gram tables of kb.Corpus to the registered
+// metrics. Distance and hand overuse depend on more than the last three keys,
+// so they only estimate what FillScore measures.
+func (kb *Keyboard) FillScoreNGrams() {
+	g := kb.geometry
+	t := tablesFor(g)
+	lookup := &kb.keyPositionLookup
+	kb.reset(kb.Corpus.Length)
+	for _, n := range kb.Corpus.unigrams {
+		kb.observe(&t.orders[1], g.index(lookup[n.a]), n.count)
+	}
+	for _, n := range kb.Corpus.bigrams {
+		kb.observe(&t.orders[2], g.bigram(lookup[n.a], lookup[n.b]), n.count)
+	}
+	for _, n := range kb.Corpus.trigrams {
+		kb.observe(&t.orders[3], g.trigram(lookup[n.a], lookup[n.b], lookup[n.c]), n.count)
+	}
+	for gap := 1; gap <= maxGap; gap++ {
+		for _, n := range kb.Corpus.skipgrams[gap] {
+			kb.observe(&t.skipgrams[gap], g.bigram(lookup[n.a], lookup[n.b]), n.count)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package keyboard
+
+import (
+	"math"
+	prand "math/rand"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFillScoreNGramsEquivalence(t *testing.T) {
+	book := strings.Repeat(testBook, 20) + "UPPER case, and 0123 digits!"
+	corpus, err := NewCorpus(book)
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	for seed := int64(0); seed < 20; seed++ {
+		kb := NewTestKeyboard()
+		kb.Fill(prand.New(prand.NewSource(seed)))
+		kb.Book = &book
+		kb.Corpus = corpus
+
+		kb.FillScore(&ScoreState{})
+		want := kb.scores.copy()
+		kb.FillScoreNGrams()
+
+		for _, r := range registry {
+			// FillScoreNGrams estimates these from n-grams.
+			if _, ok := r.Metric.(SequenceMetric); ok {
+				continue
+			}
+			got, expected := kb.value(r), want.value(r)
+			if math.Abs(got-expected) > 1e-9*math.Abs(expected) {
+				t.Errorf("seed %d: %s is %v but FillScore gives %v", seed, r.Name(), got, expected)
+			}
+		}
+	}
+}
+
+func TestNewCorpusNonASCII(t *testing.T) {
+	if _, err := NewCorpus("naïve"); nil == err {
+		t.Errorf("expected an error for a non-ASCII book")
+	}
+}
+
+func TestBlendCorpora(t *testing.T) {
+	short, _ := NewCorpus("ab")
+	long, _ := NewCorpus(strings.Repeat("cd", 500))
+
+	alone, err := BlendCorpora([]*Corpus{long}, []float64{0.3})
+	if nil != err {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(alone, long) {
+		t.Errorf("expected a single corpus to blend into itself")
+	}
+
+	for _, c := range []struct {
+		short, long float64
+	}{{1, 1}, {0.2, 0.8}, {3, 1}} {
+		blend, err := BlendCorpora([]*Corpus{short, long}, []float64{c.short, c.long})
+		if nil != err {
+			t.Fatal(err)
+		}
+		share := float64(blend.counts['a']+blend.counts['b']) / float64(blend.Length)
+		if want := c.short / (c.short + c.long); math.Abs(share-want) > 1e-9 {
+			t.Errorf("weights %v: expected the short corpus to make up %v of the blend but got %v", c, want, share)
+		}
+		if blend.counts['c'] != blend.counts['d'] || blend.counts['a'] != blend.counts['b'] {
+			t.Errorf("weights %v: expected the blend to keep the proportions within each corpus", c)
+		}
+	}
+
+	if _, err := BlendCorpora([]*Corpus{short, long}, []float64{1, 0}); nil == err {
+		t.Errorf("expected an error for a zero weight")
+	}
+}
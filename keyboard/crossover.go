@@ -0,0 +1,185 @@
+package keyboard
+
+import (
+	"fmt"
+	prand "math/rand"
+)
+
+// Genome lists the characters on the free keys of kb in row major order.
+func (kb *Keyboard) Genome() []byte {
+	g := kb.geometry
+	genome := make([]byte, 0, g.free)
+	for i := 0; i < g.rows; i++ {
+		for j := 0; j < g.cols; j++ {
+			if g.isFree(i, j) {
+				genome = append(genome, kb.layout[i][j])
+			}
+		}
+	}
+	return genome
+}
+
+// NewFromGenome returns a keyboard with the characters of genome on the free
+// keys of g in row major order.
+func NewFromGenome(g *Geometry, genome []byte) (*Keyboard, error) {
+	if len(genome) != g.free {
+		return nil, fmt.Errorf("genome has %d characters but the geometry has %d free keys", len(genome), g.free)
+	}
+	kb := &Keyboard{geometry: g, layout: newLayout(g)}
+	kb.SetGenome(genome)
+	return kb, nil
+}
+
+// SetGenome places the characters of genome on the free keys of kb in row
+// major order. The score is not updated.
+func (kb *Keyboard) SetGenome(genome []byte) {
+	g := kb.geometry
+	kb.keyPositionLookup = [128]KeyPosition{}
+	k := 0
+	for i := 0; i < g.rows; i++ {
+		for j := 0; j < g.cols; j++ {
+			if !g.isFree(i, j) {
+				continue
+			}
+			kb.layout[i][j] = genome[k]
+			if genome[k] != 0 {
+				kb.keyPositionLookup[genome[k]] = KeyPosition{i, j}
+			}
+			k++
+		}
+	}
+}
+
+// The crossover operators combine the genomes of a and b into a new layout.
+// Both parents must place the same characters, and every character in the
+// child appears exactly once. The child is not scored. Random choices are
+// drawn from r; cycle crossover makes none and only takes r to share the
+// signature of the others.
+
+func PartiallyMappedCrossover(r *prand.Rand, a, b *Keyboard) *Keyboard {
+	pa, pb := a.Genome(), b.Genome()
+	i, j := cutPoints(r, len(pa))
+	return a.child(pmx(pa, pb, i, j))
+}
+
+func CycleCrossover(r *prand.Rand, a, b *Keyboard) *Keyboard {
+	return a.child(cx(a.Genome(), b.Genome()))
+}
+
+func OrderCrossover(r *prand.Rand, a, b *Keyboard) *Keyboard {
+	pa, pb := a.Genome(), b.Genome()
+	i, j := cutPoints(r, len(pa))
+	return a.child(ox(pa, pb, i, j))
+}
+
+func (kb *Keyboard) child(genome []byte) *Keyboard {
+	c := &Keyboard{
+		Book:     kb.Book,
+		Corpus:   kb.Corpus,
+		geometry: kb.geometry,
+		layout:   newLayout(kb.geometry),
+	}
+	c.SetGenome(genome)
+	return c
+}
+
+func cutPoints(r *prand.Rand, n int) (int, int) {
+	i, j := r.Intn(n), r.Intn(n)
+	if i > j {
+		i, j = j, i
+	}
+	return i, j + 1
+}
+
+func indexOf(genome []byte) [128]int {
+	index := [128]int{}
+	for i, c := range genome {
+		index[c] = i
+	}
+	return index
+}
+
+// pmx copies pa[i:j] into the child and places the rest of pb around it,
+// following the mapping between the two segments when a value of pb is
+// displaced by the copied segment.
+func pmx(pa, pb []byte, i, j int) []byte {
+	child := make([]byte, len(pa))
+	placed := [128]bool{}
+	copy(child[i:j], pa[i:j])
+	for _, c := range pa[i:j] {
+		placed[c] = true
+	}
+
+	inB := indexOf(pb)
+	filled := make([]bool, len(pa))
+	for k := i; k < j; k++ {
+		filled[k] = true
+	}
+	for k := i; k < j; k++ {
+		v := pb[k]
+		if placed[v] {
+			continue
+		}
+		pos := k
+		for pos >= i && pos < j {
+			pos = inB[pa[pos]]
+		}
+		child[pos] = v
+		filled[pos] = true
+		placed[v] = true
+	}
+	for k := range child {
+		if !filled[k] {
+			child[k] = pb[k]
+		}
+	}
+	return child
+}
+
+// cx splits the positions into cycles between the parents and takes
+// alternate cycles from each.
+func cx(pa, pb []byte) []byte {
+	child := make([]byte, len(pa))
+	visited := make([]bool, len(pa))
+	inA := indexOf(pa)
+	fromA := true
+	for start := range pa {
+		if visited[start] {
+			continue
+		}
+		for k := start; !visited[k]; k = inA[pb[k]] {
+			visited[k] = true
+			if fromA {
+				child[k] = pa[k]
+			} else {
+				child[k] = pb[k]
+			}
+		}
+		fromA = !fromA
+	}
+	return child
+}
+
+// ox copies pa[i:j] into the child and fills the remaining positions, from j
+// onwards and wrapping around, with the missing values in the order they
+// appear in pb from j.
+func ox(pa, pb []byte, i, j int) []byte {
+	n := len(pa)
+	child := make([]byte, n)
+	placed := [128]bool{}
+	copy(child[i:j], pa[i:j])
+	for _, c := range pa[i:j] {
+		placed[c] = true
+	}
+	k := j % n
+	for m := 0; m < n; m++ {
+		v := pb[(j+m)%n]
+		if placed[v] {
+			continue
+		}
+		child[k] = v
+		placed[v] = true
+		k = (k + 1) % n
+	}
+	return child
+}
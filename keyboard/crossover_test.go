@@ -0,0 +1,56 @@
+package keyboard
+
+import (
+	prand "math/rand"
+	"testing"
+)
+
+func checkInvariants(t *testing.T, name string, kb *Keyboard) {
+	seen := map[byte]bool{}
+	g := kb.geometry
+	for i, row := range kb.layout {
+		for j, c := range row {
+			if !g.isFree(i, j) {
+				continue
+			}
+			if seen[c] {
+				t.Errorf("%s: %q is placed twice", name, c)
+			}
+			seen[c] = true
+			if p := kb.keyPositionLookup[c]; p.i != i || p.j != j {
+				t.Errorf("%s: %q is at (%d, %d) but looked up at (%d, %d)", name, c, i, j, p.i, p.j)
+			}
+		}
+	}
+	for _, c := range Chars {
+		if !seen[c] {
+			t.Errorf("%s: %q is not placed", name, c)
+		}
+	}
+}
+
+func TestCrossover(t *testing.T) {
+	r := prand.New(prand.NewSource(0))
+	operators := map[string]func(r *prand.Rand, a, b *Keyboard) *Keyboard{
+		"pmx": PartiallyMappedCrossover,
+		"cx":  CycleCrossover,
+		"ox":  OrderCrossover,
+	}
+	a := NewTestKeyboard()
+	for seed := int64(1); seed < 50; seed++ {
+		b := a.Copy()
+		b.Fill(prand.New(prand.NewSource(seed)))
+		for name, crossover := range operators {
+			checkInvariants(t, name, crossover(r, a, b))
+		}
+		a = b
+	}
+}
+
+func TestGenome(t *testing.T) {
+	kb := NewTestKeyboard()
+	c := kb.child(kb.Genome())
+	if c.String() != kb.String() {
+		t.Errorf("expected\n%v\nbut got\n%v", kb, c)
+	}
+}
@@ -0,0 +1,252 @@
+package keyboard
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+)
+
+// Key describes a single physical key.
+type Key struct {
+	Row        int     `json:"row"`
+	Col        int     `json:"col"`
+	X          float64 `json:"x"`
+	Y          float64 `json:"y"`
+	Finger     int     `json:"finger"`
+	Hand       int     `json:"hand"`
+	HandFinger int     `json:"handFinger"`
+	HandColumn int     `json:"handColumn"`
+	Effort     int64   `json:"effort"`
+	Reserved   string  `json:"reserved,omitempty"`
+}
+
+type keyRef struct {
+	Row int `json:"row"`
+	Col int `json:"col"`
+}
+
+type geometryFile struct {
+	Name string     `json:"name"`
+	Home [10]keyRef `json:"home"`
+	Keys []Key      `json:"keys"`
+}
+
+// Geometry is the physical description of a keyboard. Finger is the absolute
+// finger (0 left pinky to 9 right pinky), HandFinger counts from the pinky (0)
+// to the thumb (4) and HandColumn counts from the outer edge of each hand.
+// Keys with a Reserved label are never assigned a character.
+type Geometry struct {
+	Name        string
+	Keys        []Key
+	keyIndex    []int
+	rows        int
+	cols        int
+	free        int
+	home        [10]KeyPosition
+	present     [][]bool
+	reserved    [][]string
+	absFinger   [][]int
+	handFinger  [][]int
+	handColumn  [][]int
+	hand        [][]int
+	effort      [][]int64
+	distances   []float64
+	transitions []int8
+}
+
+func NewGeometry(name string, keys []Key, home [10]KeyPosition) (*Geometry, error) {
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("geometry %v has no keys", name)
+	}
+	g := &Geometry{Name: name, Keys: keys, home: home}
+	for _, k := range keys {
+		if k.Row < 0 || k.Col < 0 {
+			return nil, fmt.Errorf("key at (%d, %d) has a negative position", k.Row, k.Col)
+		}
+		if k.Row >= g.rows {
+			g.rows = k.Row + 1
+		}
+		if k.Col >= g.cols {
+			g.cols = k.Col + 1
+		}
+	}
+
+	g.present = make([][]bool, g.rows)
+	g.reserved = make([][]string, g.rows)
+	g.absFinger = make([][]int, g.rows)
+	g.handFinger = make([][]int, g.rows)
+	g.handColumn = make([][]int, g.rows)
+	g.hand = make([][]int, g.rows)
+	g.effort = make([][]int64, g.rows)
+	for i := 0; i < g.rows; i++ {
+		g.present[i] = make([]bool, g.cols)
+		g.reserved[i] = make([]string, g.cols)
+		g.absFinger[i] = make([]int, g.cols)
+		g.handFinger[i] = make([]int, g.cols)
+		g.handColumn[i] = make([]int, g.cols)
+		g.hand[i] = make([]int, g.cols)
+		g.effort[i] = make([]int64, g.cols)
+	}
+
+	g.keyIndex = make([]int, g.rows*g.cols)
+	for i := range g.keyIndex {
+		g.keyIndex[i] = -1
+	}
+	for n, k := range keys {
+		i, j := k.Row, k.Col
+		switch {
+		case g.present[i][j]:
+			return nil, fmt.Errorf("key at (%d, %d) is declared twice", i, j)
+		case k.Finger < 0 || k.Finger > 9:
+			return nil, fmt.Errorf("key at (%d, %d) has finger %d, want 0-9", i, j, k.Finger)
+		case k.Hand != 0 && k.Hand != 1:
+			return nil, fmt.Errorf("key at (%d, %d) has hand %d, want 0 or 1", i, j, k.Hand)
+		case k.Finger/5 != k.Hand:
+			return nil, fmt.Errorf("key at (%d, %d) has finger %d of hand %d but hand %d", i, j, k.Finger, k.Finger/5, k.Hand)
+		case k.HandFinger < 0 || k.HandFinger > 4:
+			return nil, fmt.Errorf("key at (%d, %d) has hand finger %d, want 0-4", i, j, k.HandFinger)
+		}
+		g.present[i][j] = true
+		g.keyIndex[g.index(KeyPosition{i, j})] = n
+		g.reserved[i][j] = k.Reserved
+		g.absFinger[i][j] = k.Finger
+		g.handFinger[i][j] = k.HandFinger
+		g.handColumn[i][j] = k.HandColumn
+		g.hand[i][j] = k.Hand
+		g.effort[i][j] = k.Effort
+		if k.Reserved == "" {
+			g.free++
+		}
+	}
+
+	for f, p := range home {
+		if p.i < 0 || p.j < 0 || p.i >= g.rows || p.j >= g.cols || !g.present[p.i][p.j] {
+			return nil, fmt.Errorf("home position (%d, %d) of finger %d is not a key", p.i, p.j, f)
+		}
+	}
+
+	n := g.rows * g.cols
+	g.distances = make([]float64, n*n)
+	g.transitions = make([]int8, n*n)
+	for _, a := range keys {
+		for _, b := range keys {
+			h := a.Y - b.Y
+			w := a.X - b.X
+			pa, pb := KeyPosition{a.Row, a.Col}, KeyPosition{b.Row, b.Col}
+			g.distances[g.index(pa)*n+g.index(pb)] = math.Sqrt(h*h + w*w)
+			g.transitions[g.index(pa)*n+g.index(pb)] = int8(g.classify(pa, pb))
+		}
+	}
+
+	return g, nil
+}
+
+func LoadGeometry(path string) (*Geometry, error) {
+	data, err := ioutil.ReadFile(path)
+	if nil != err {
+		return nil, err
+	}
+	g := &Geometry{}
+	if err := json.Unmarshal(data, g); nil != err {
+		return nil, fmt.Errorf("unable to parse geometry %v: %w", path, err)
+	}
+	return g, nil
+}
+
+func (g *Geometry) UnmarshalJSON(data []byte) error {
+	var f geometryFile
+	if err := json.Unmarshal(data, &f); nil != err {
+		return err
+	}
+	home := [10]KeyPosition{}
+	for i, h := range f.Home {
+		home[i] = KeyPosition{h.Row, h.Col}
+	}
+	ng, err := NewGeometry(f.Name, f.Keys, home)
+	if nil != err {
+		return err
+	}
+	*g = *ng
+	return nil
+}
+
+func (g *Geometry) MarshalJSON() ([]byte, error) {
+	f := geometryFile{Name: g.Name, Keys: g.Keys}
+	for i, h := range g.home {
+		f.Home[i] = keyRef{h.i, h.j}
+	}
+	return json.Marshal(f)
+}
+
+// FreeKeys is the number of keys that characters can be placed on.
+func (g *Geometry) FreeKeys() int {
+	return g.free
+}
+
+func (g *Geometry) Rows() int {
+	return g.rows
+}
+
+func (g *Geometry) Cols() int {
+	return g.cols
+}
+
+// Key returns the key at p. Metrics are also observed on positions without a
+// key, for which Key returns a zero Key with only the position set.
+func (g *Geometry) Key(p KeyPosition) Key {
+	if k := g.keyIndex[g.index(p)]; k >= 0 {
+		return g.Keys[k]
+	}
+	return Key{Row: p.i, Col: p.j}
+}
+
+func (p KeyPosition) Row() int {
+	return p.i
+}
+
+func (p KeyPosition) Col() int {
+	return p.j
+}
+
+func (g *Geometry) index(p KeyPosition) int {
+	return p.i*g.cols + p.j
+}
+
+func (g *Geometry) distance(a, b KeyPosition) float64 {
+	return g.distances[g.index(a)*g.rows*g.cols+g.index(b)]
+}
+
+// isFree reports whether a character can be placed at (i, j).
+func (g *Geometry) isFree(i, j int) bool {
+	return g.present[i][j] && g.reserved[i][j] == ""
+}
+
+// DefaultGeometry is the 4x12 ortholinear board the optimizer was written for.
+func DefaultGeometry() *Geometry {
+	keys := []Key{}
+	for i, row := range reserved {
+		for j, r := range row {
+			k := Key{
+				Row:        i,
+				Col:        j,
+				X:          float64(j),
+				Y:          float64(i),
+				Finger:     absFinger[i][j],
+				Hand:       hand[i][j],
+				HandFinger: handFinger[i][j],
+				HandColumn: handColumn[i][j],
+				Effort:     effort[i][j],
+			}
+			if r != 'x' {
+				k.Reserved = string(keyPrintingMap[r])
+			}
+			keys = append(keys, k)
+		}
+	}
+	g, err := NewGeometry("ortho-4x12", keys, defaultHome)
+	if nil != err {
+		panic(err)
+	}
+	return g
+}
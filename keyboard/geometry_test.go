@@ -0,0 +1,45 @@
+package keyboard
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLoadGeometry(t *testing.T) {
+	g, err := LoadGeometry("../geometries/ortho-4x12.json")
+	if nil != err {
+		t.Fatal(err)
+	}
+	d := DefaultGeometry()
+	if !reflect.DeepEqual(g, d) {
+		t.Errorf("geometries/ortho-4x12.json does not match the default geometry")
+	}
+	if g.FreeKeys() != 35 {
+		t.Errorf("expected 35 free keys but got %d", g.FreeKeys())
+	}
+}
+
+func TestGeometryDuplicateKey(t *testing.T) {
+	keys := []Key{{Row: 0, Col: 0}, {Row: 0, Col: 0}}
+	if _, err := NewGeometry("dupe", keys, [10]KeyPosition{}); nil == err {
+		t.Errorf("expected an error for a key declared twice")
+	}
+}
+
+func TestGeometryHomeNotAKey(t *testing.T) {
+	keys := []Key{{Row: 0, Col: 0}, {Row: 0, Col: 1}}
+	for _, p := range []KeyPosition{{-1, 0}, {0, -1}, {1, 0}, {0, 2}} {
+		home := [10]KeyPosition{}
+		home[3] = p
+		if _, err := NewGeometry("home", keys, home); nil == err {
+			t.Errorf("expected an error for the home position (%d, %d)", p.i, p.j)
+		}
+	}
+}
+
+func TestGeometryFingerOfOtherHand(t *testing.T) {
+	keys := []Key{{Row: 0, Col: 0, Finger: 7, Hand: 0}}
+	if _, err := NewGeometry("hands", keys, [10]KeyPosition{}); nil == err {
+		t.Errorf("expected an error for a finger of the other hand")
+	}
+}
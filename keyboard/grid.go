@@ -0,0 +1,134 @@
+package keyboard
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Grid symbols for characters that would otherwise be invisible, and for keys
+// that hold no character.
+const (
+	gridSpace   = "␣"
+	gridNewline = "↩"
+	gridTab     = "⇥"
+	gridEmpty   = "·"
+)
+
+// GridRows returns the layout as one line per row of the geometry, with the
+// keys separated by spaces. Reserved, missing and empty keys are written as ·.
+func (kb *Keyboard) GridRows() []string {
+	g := kb.geometry
+	rows := make([]string, g.rows)
+	for i, row := range kb.layout {
+		tokens := make([]string, g.cols)
+		for j, ch := range row {
+			if g.isFree(i, j) {
+				tokens[j] = gridSymbol(ch)
+			} else {
+				tokens[j] = gridEmpty
+			}
+		}
+		rows[i] = strings.Join(tokens, " ")
+	}
+	return rows
+}
+
+func gridSymbol(ch byte) string {
+	switch ch {
+	case 0:
+		return gridEmpty
+	case ' ':
+		return gridSpace
+	case '\n':
+		return gridNewline
+	case '\t':
+		return gridTab
+	}
+	return string(ch)
+}
+
+// Grid returns GridRows as a single string ending in a newline.
+func (kb *Keyboard) Grid() string {
+	return strings.Join(kb.GridRows(), "\n") + "\n"
+}
+
+// ParseLayout reads a layout in the format written by Grid. Blank lines and
+// lines starting with # are ignored. Every other line is a row of the
+// geometry, with one space separated token per column: a character, one of
+// the symbols ␣ ↩ ⇥, or · for a key without a character. Keys that are
+// reserved or missing in g must be ·.
+func ParseLayout(g *Geometry, text string) (*Keyboard, error) {
+	kb := &Keyboard{geometry: g, layout: newLayout(g)}
+	i := 0
+	for n, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if i == g.rows {
+			return nil, fmt.Errorf("line %d: the geometry has only %d rows", n+1, g.rows)
+		}
+		tokens := strings.Fields(line)
+		if len(tokens) != g.cols {
+			return nil, fmt.Errorf("line %d: found %d keys but the geometry has %d columns", n+1, len(tokens), g.cols)
+		}
+		for j, token := range tokens {
+			var ch byte
+			switch {
+			case token == gridEmpty:
+				continue
+			case token == gridSpace:
+				ch = ' '
+			case token == gridNewline:
+				ch = '\n'
+			case token == gridTab:
+				ch = '\t'
+			case len(token) == 1 && token[0] < 128:
+				ch = token[0]
+			default:
+				return nil, fmt.Errorf("line %d: %q is not a character", n+1, token)
+			}
+			if !g.isFree(i, j) {
+				return nil, fmt.Errorf("line %d: %q is on a key that is reserved or missing", n+1, token)
+			}
+			kb.layout[i][j] = ch
+			kb.keyPositionLookup[ch] = KeyPosition{i, j}
+		}
+		i++
+	}
+	if i != g.rows {
+		return nil, fmt.Errorf("found %d rows but the geometry has %d", i, g.rows)
+	}
+	return kb, nil
+}
+
+// Validate checks that every character of Chars is placed exactly once and
+// that nothing else is placed.
+func (kb *Keyboard) Validate() error {
+	want := [128]bool{}
+	for _, c := range Chars {
+		want[c] = true
+	}
+	placed := [128]int{}
+	for _, row := range kb.layout {
+		for _, c := range row {
+			if c == 0 {
+				continue
+			}
+			if !want[c] {
+				return fmt.Errorf("%q is placed but is not one of the corpus characters", c)
+			}
+			placed[c]++
+		}
+	}
+	for _, c := range Chars {
+		switch placed[c] {
+		case 0:
+			return fmt.Errorf("%q is not placed", c)
+		case 1:
+		default:
+			return fmt.Errorf("%q is placed %d times", c, placed[c])
+		}
+	}
+	return nil
+}
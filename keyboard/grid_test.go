@@ -0,0 +1,44 @@
+package keyboard
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseLayout(t *testing.T) {
+	kb := NewTestKeyboard()
+	parsed, err := ParseLayout(kb.geometry, "# test layout\n\n"+kb.Grid())
+	if nil != err {
+		t.Fatal(err)
+	}
+	if string(parsed.Genome()) != string(kb.Genome()) {
+		t.Errorf("expected %q but got %q", kb.Genome(), parsed.Genome())
+	}
+	if parsed.keyPositionLookup != kb.keyPositionLookup {
+		t.Errorf("lookup does not match the layout")
+	}
+	if err := parsed.Validate(); nil != err {
+		t.Error(err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	kb := NewTestKeyboard()
+	grid := kb.Grid()
+	for name, text := range map[string]string{
+		"duplicate": strings.Replace(grid, "z", "e", 1),
+		"missing":   strings.Replace(grid, "z", gridEmpty, 1),
+		"foreign":   strings.Replace(grid, "z", "Z", 1),
+	} {
+		parsed, err := ParseLayout(kb.geometry, text)
+		if nil != err {
+			t.Fatal(err)
+		}
+		if err := parsed.Validate(); nil == err {
+			t.Errorf("%v: expected a validation error", name)
+		}
+	}
+	if _, err := ParseLayout(kb.geometry, strings.Replace(grid, gridEmpty, "x", 1)); nil == err {
+		t.Errorf("expected an error for a character on a reserved key")
+	}
+}
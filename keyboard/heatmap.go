@@ -0,0 +1,112 @@
+package keyboard
+
+import (
+	"fmt"
+	"strings"
+)
+
+// KeyHeat is what typing the corpus costs on one key of a layout. Presses is
+// how often the key is pressed and Frequency its share of all presses.
+// SameFinger counts the same finger bigrams the key is part of, with each
+// bigram split evenly between its two keys so that the keys add up to the
+// repeated finger metric. Effort is the presses weighed by the key's effort.
+type KeyHeat struct {
+	Row        int     `json:"row"`
+	Col        int     `json:"col"`
+	Char       string  `json:"char"`
+	Presses    int64   `json:"presses"`
+	Frequency  float64 `json:"frequency"`
+	SameFinger float64 `json:"sameFinger"`
+	Effort     float64 `json:"effort"`
+}
+
+// Heatmap returns the cost of every key with a character, in row major order.
+// The keyboard must have a corpus.
+func (kb *Keyboard) Heatmap() []KeyHeat {
+	g := kb.geometry
+	c := kb.Corpus
+	sameFinger := make([][]float64, g.rows)
+	for i := range sameFinger {
+		sameFinger[i] = make([]float64, g.cols)
+	}
+	for _, n := range c.bigrams {
+		a, b := kb.keyPositionLookup[n.a], kb.keyPositionLookup[n.b]
+		if g.absFinger[a.i][a.j] == g.absFinger[b.i][b.j] {
+			sameFinger[a.i][a.j] += float64(n.count) / 2
+			sameFinger[b.i][b.j] += float64(n.count) / 2
+		}
+	}
+
+	heat := []KeyHeat{}
+	for i, row := range kb.layout {
+		for j, ch := range row {
+			if !g.isFree(i, j) || ch == 0 {
+				continue
+			}
+			presses := c.counts[ch]
+			h := KeyHeat{
+				Row:        i,
+				Col:        j,
+				Char:       string(ch),
+				Presses:    presses,
+				SameFinger: sameFinger[i][j],
+				Effort:     float64(presses * g.effort[i][j]),
+			}
+			if c.Length > 0 {
+				h.Frequency = float64(presses) / float64(c.Length)
+			}
+			heat = append(heat, h)
+		}
+	}
+	return heat
+}
+
+// HeatmapString draws the frequency, same finger bigrams and effort of every
+// key over the layout, colored from the coolest to the hottest key of each
+// map with the effort palette.
+func (kb *Keyboard) HeatmapString() string {
+	g := kb.geometry
+	heat := kb.Heatmap()
+	var str strings.Builder
+	for _, m := range []struct {
+		title  string
+		format string
+		value  func(h KeyHeat) float64
+	}{
+		{"Frequency %", "%6.1f", func(h KeyHeat) float64 { return h.Frequency * 100 }},
+		{"Same Finger Bigrams", "%6.0f", func(h KeyHeat) float64 { return h.SameFinger }},
+		{"Effort", "%6.0f", func(h KeyHeat) float64 { return h.Effort }},
+	} {
+		max := 0.0
+		for _, h := range heat {
+			if v := m.value(h); v > max {
+				max = v
+			}
+		}
+		cells := make([][]string, g.rows)
+		for i := range cells {
+			cells[i] = make([]string, g.cols)
+			for j := range cells[i] {
+				cells[i][j] = strings.Repeat(" ", 8)
+				if g.present[i][j] && g.reserved[i][j] != "" {
+					cells[i][j] = grey + fmt.Sprintf("%-8v", g.reserved[i][j]) + reset
+				}
+			}
+		}
+		for _, h := range heat {
+			v := m.value(h)
+			level := int64(0)
+			if max > 0 {
+				level = int64(9 * v / max)
+			}
+			cells[h.Row][h.Col] = effortColor[level] + gridSymbol(h.Char[0]) + " " + fmt.Sprintf(m.format, v) + reset
+		}
+		fmt.Fprintf(&str, "\n    %v\n\n", m.title)
+		for _, row := range cells {
+			str.WriteString("    ")
+			str.WriteString(strings.Join(row, "  "))
+			str.WriteByte('\n')
+		}
+	}
+	return str.String()
+}
@@ -0,0 +1,40 @@
+package keyboard
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestHeatmap(t *testing.T) {
+	kb := NewTestKeyboard()
+	// Every character of the book must be on the layout for the keys to add
+	// up to the metrics.
+	kb.Corpus, _ = NewCorpus(strings.ToLower(testBook))
+	kb.FillScoreNGrams()
+
+	heat := kb.Heatmap()
+	if len(heat) != len(Chars) {
+		t.Fatalf("expected %d keys but got %d", len(Chars), len(heat))
+	}
+	var presses int64
+	var frequency, sameFinger, effort float64
+	for _, h := range heat {
+		if kb.layout[h.Row][h.Col] != h.Char[0] {
+			t.Errorf("%q is not on %v,%v", h.Char, h.Row, h.Col)
+		}
+		presses += h.Presses
+		frequency += h.Frequency
+		sameFinger += h.SameFinger
+		effort += h.Effort
+	}
+	if presses != kb.Corpus.Length || math.Abs(frequency-1) > 1e-9 {
+		t.Errorf("expected the keys to be pressed %d times in all but got %d, %v of the presses", kb.Corpus.Length, presses, frequency)
+	}
+	if want := kb.value(lookupMetric(WeightRepeatedPresses)); sameFinger != want {
+		t.Errorf("expected %v same finger bigrams but the keys add up to %v", want, sameFinger)
+	}
+	if want := kb.value(lookupMetric(WeightEffort)); effort != want {
+		t.Errorf("expected an effort of %v but the keys add up to %v", want, effort)
+	}
+}
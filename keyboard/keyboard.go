@@ -3,15 +3,11 @@ package keyboard
 import (
 	"fmt"
 	"log"
-	"math"
 	prand "math/rand"
 	"strings"
-	"time"
 )
 
-const NChars = 35
-
-var Chars = [NChars]byte{}
+var Chars = []byte{}
 
 var reserved = [4][12]byte{
 	{'E', 'x', 'x', 'x', 'x', 'x', 'x', 'x', 'x', 'x', 'x', 'x'},
@@ -72,7 +68,7 @@ var effort = [4][12]int64{
 	{7, 9, 9, 7, 1, 0, 0, 1, 0, 0, 0, 0},
 }
 
-var fingerPosition = [10]KeyPosition{
+var defaultHome = [10]KeyPosition{
 	{1, 1}, {1, 2}, {1, 3}, {1, 4}, {3, 5},
 	{3, 6}, {1, 7}, {1, 8}, {1, 9}, {1, 10},
 }
@@ -104,168 +100,113 @@ type KeyPosition struct {
 
 type Keyboard struct {
 	Book              *string
-	layout            [4][12]byte
+	Corpus            *Corpus
+	geometry          *Geometry
+	layout            [][]byte
 	keyPositionLookup [128]KeyPosition
-	handOverUse       int64
-	repeatedPresses   int64
-	repeatFinger1Gap  int64
-	effort            int64
-	inward            int64
-	comfyInward       int64
-	outward           int64
-	comfyOutward      int64
-	rowjump           int64
-	distance          float64
-	fingers           []float64
-	hands             []float64
-	fingerInequality  float64
-	handInequality    float64
-	Thread            int
-	Gen               int
-	Total             int
-	Mutation          int
-	Iteration         int
+	scores
+	Thread    int
+	Gen       int
+	Total     int
+	Mutation  int
+	Iteration int
 }
 
-func New() *Keyboard {
+func New(g *Geometry, r *prand.Rand) *Keyboard {
 	kb := &Keyboard{}
-	kb.layout = [4][12]byte{}
+	kb.geometry = g
+	kb.layout = newLayout(g)
 	kb.keyPositionLookup = [128]KeyPosition{}
-	kb.Fill(time.Now().Unix())
+	kb.Fill(r)
 	return kb
 }
 
-func (kb *Keyboard) Fill(seed int64) {
-	shars := Chars
-	prand.Seed(seed)
-	prand.Shuffle(len(Chars), func(i, j int) {
-		shars[i], shars[j] = shars[j], shars[i]
-	})
-	for i, j := 0, 0; i < 48; i++ {
-		p := i / 12
-		q := i % 12
-		if reserved[p][q] != 'x' {
-			kb.layout[p][q] = reserved[p][q]
-			continue
-		}
-		kb.layout[p][q] = shars[j]
-		kb.keyPositionLookup[kb.layout[p][q]] = KeyPosition{p, q}
-		j++
+func newLayout(g *Geometry) [][]byte {
+	backing := make([]byte, g.rows*g.cols)
+	layout := make([][]byte, g.rows)
+	for i := range layout {
+		layout[i] = backing[i*g.cols : (i+1)*g.cols]
 	}
+	return layout
 }
 
-func (kb *Keyboard) FillScore(distances *[4][12][4][12]float64) {
-	keyZ := kb.keyPositionLookup[' ']
-	keyA := kb.keyPositionLookup[' ']
-
-	fingerUsage := [10]int64{}
-	handUsage := [2]int64{}
-	wasAnInroll := false
-	wasAnOutroll := false
-
-	for _, b := range []byte(*kb.Book) {
-		keyB := kb.keyPositionLookup[b]
-		ai, aj, bi, bj, zi, zj := keyA.i, keyA.j, keyB.i, keyB.j, keyZ.i, keyZ.j
-		afa, afb, afz := absFinger[ai][aj], absFinger[bi][bj], absFinger[zi][zj]
-
-		if afa == afb {
-			kb.repeatedPresses++
-		}
-
-		if afz == afb {
-			kb.repeatFinger1Gap++
-		}
-
-		// Add finger usage
-		fingerUsage[afb]++
+func (kb *Keyboard) Geometry() *Geometry {
+	return kb.geometry
+}
 
-		// This is a same hand movement
-		if hand[ai][aj] == hand[bi][bj] {
-			if handFinger[ai][aj] < handFinger[bi][bj] && handColumn[ai][aj] < handColumn[bi][bj] {
-				if effort[ai][aj] <= 2 && effort[bi][bj] <= 2 {
-					kb.comfyInward++
-				} else {
-					kb.inward++
-				}
-				if (wasAnOutroll) && hand[bi][bj] == hand[ai][aj] {
-					kb.handOverUse++
-				}
-				wasAnInroll = true
-				wasAnOutroll = false
-			} else if handFinger[ai][aj] > handFinger[bi][bj] && handColumn[ai][aj] > handColumn[bi][bj] {
-				if effort[ai][aj] <= 2 && effort[bi][bj] <= 2 {
-					kb.comfyOutward++
-				} else {
-					kb.outward++
-				}
-				if (wasAnInroll) && hand[bi][bj] == hand[ai][aj] {
-					kb.handOverUse++
-				}
-				wasAnInroll = false
-				wasAnOutroll = true
-			} else if handFinger[ai][aj] != 4 && handFinger[bi][bj] != 4 && math.Abs(float64(bi)-float64(ai)) > 1.0 {
-				if (wasAnInroll || wasAnOutroll) && hand[bi][bj] == hand[ai][aj] {
-					kb.handOverUse++
-				}
-				kb.rowjump++
-				wasAnInroll = false
-				wasAnOutroll = false
-			} else {
-				if (wasAnInroll || wasAnOutroll) && hand[bi][bj] == hand[ai][aj] {
-					kb.handOverUse++
-				}
-				wasAnInroll = false
-				wasAnOutroll = false
+func (kb *Keyboard) Fill(r *prand.Rand) {
+	g := kb.geometry
+	shars := make([]byte, len(Chars))
+	copy(shars, Chars)
+	r.Shuffle(len(shars), func(i, j int) {
+		shars[i], shars[j] = shars[j], shars[i]
+	})
+	for p, j := 0, 0; p < g.rows; p++ {
+		for q := 0; q < g.cols; q++ {
+			if !g.isFree(p, q) || j == len(shars) {
+				kb.layout[p][q] = 0
+				continue
 			}
+			kb.layout[p][q] = shars[j]
+			kb.keyPositionLookup[kb.layout[p][q]] = KeyPosition{p, q}
+			j++
 		}
-
-		q := fingerPosition[afb]
-		kb.distance += distances[bi][bj][q.i][q.j]
-
-		// kb.distance += math.Sqrt(h*h + w*w)
-		fingerPosition[afb] = KeyPosition{bi, bj}
-
-		kb.effort += effort[bi][bj]
-
-		keyZ, keyA = keyA, keyB
 	}
+}
 
-	inequality := 0.0
-	handInequality := 0.0
-	kb.fingers = make([]float64, 10)
-	for i, fu := range fingerUsage {
-		usage := (float64(fu) / float64(len(*(kb.Book))))
-		kb.fingers[i] = usage
-		inequality += math.Abs(targetFingerUsage[i] - usage)
-		if i <= 4 {
-			handUsage[0] += fu
-		} else {
-			handUsage[1] += fu
+// ScoreState holds the states of the SequenceMetrics for FillScore.
+type ScoreState struct {
+	states []SequenceState
+}
+
+func (s *ScoreState) reset(g *Geometry) {
+	if len(s.states) != len(sequences) {
+		s.states = make([]SequenceState, len(sequences))
+		for i, r := range sequences {
+			s.states[i] = r.Metric.(SequenceMetric).NewState()
 		}
 	}
+	for _, state := range s.states {
+		state.Reset(g)
+	}
+}
 
-	kb.hands = make([]float64, 2)
-	for i, hu := range handUsage {
-		usage := (float64(hu) / float64(len(*(kb.Book))))
-		kb.hands[i] = usage
-		handInequality += math.Abs(0.5 - usage)
+// FillScore walks the book and records the metrics used by Score. It is the
+// exact scorer: SequenceMetrics such as distance and hand overuse are walked
+// key press by key press, while FillScoreNGrams estimates them from n-grams.
+// Every other metric has the same value from both. All state carried between
+// key presses lives in s, which must not be shared between concurrent calls.
+func (kb *Keyboard) FillScore(s *ScoreState) {
+	g := kb.geometry
+	t := tablesFor(g)
+	book := *kb.Book
+	s.reset(g)
+	kb.reset(int64(len(book)))
+	// history[k] is the key pressed k+1 presses ago.
+	history := [maxGap + 1]KeyPosition{}
+	for i := range history {
+		history[i] = kb.keyPositionLookup[' ']
 	}
+	for i := 0; i < len(book); i++ {
+		keyB := kb.keyPositionLookup[book[i]]
+		keyZ, keyA := history[1], history[0]
+		kb.press(&t.orders[1], g.index(keyB))
+		kb.press(&t.orders[2], g.bigram(keyA, keyB))
+		kb.press(&t.orders[3], g.trigram(keyZ, keyA, keyB))
+		for gap := 1; gap <= maxGap; gap++ {
+			kb.observe(&t.skipgrams[gap], g.bigram(history[gap], keyB), 1)
+		}
+		for k, r := range sequences {
+			s.states[k].Press(g, keyA, keyB, kb.acc[r.offset:r.offset+r.size])
+		}
 
-	kb.fingerInequality = inequality
-	kb.handInequality = handInequality
+		copy(history[1:], history[:maxGap])
+		history[0] = keyB
+	}
 }
 
 func (kb *Keyboard) Score() float64 {
-	return 100000 + ((kb.distance/4)+
-		float64(kb.repeatedPresses*2)+
-		float64(kb.repeatFinger1Gap)+
-		float64(kb.effort)*0.04-
-		float64(kb.comfyInward)-
-		(float64(kb.inward)/4)-
-		(float64(kb.comfyOutward)/2)-
-		(float64(kb.outward)/8)+
-		float64(kb.handOverUse/2))*
-		(1+(kb.fingerInequality/4))
+	return kb.scores.score()
 }
 
 func (kb *Keyboard) Copy() *Keyboard {
@@ -273,32 +214,36 @@ func (kb *Keyboard) Copy() *Keyboard {
 	for k, v := range kb.keyPositionLookup {
 		newLookup[k] = v
 	}
-	newLayout := [4][12]byte{}
+	newLayout := newLayout(kb.geometry)
 	for i, v := range kb.layout {
-		for j, w := range v {
-			newLayout[i][j] = w
-		}
+		copy(newLayout[i], v)
 	}
 	return &Keyboard{
+		Book:              kb.Book,
+		Corpus:            kb.Corpus,
+		geometry:          kb.geometry,
 		layout:            newLayout,
 		keyPositionLookup: newLookup,
+		scores:            kb.scores.copy(),
 	}
 }
 
-func (kb *Keyboard) Mutate() (s, t int) {
-	a := prand.Int31n(NChars) // 16
-	b := prand.Int31n(NChars) // 3
+func (kb *Keyboard) Mutate(r *prand.Rand) (s, t int) {
+	a := r.Int31n(int32(len(Chars))) // 16
+	b := r.Int31n(int32(len(Chars))) // 3
 
-	ca := Chars[a]
-	cb := Chars[b]
+	kb.Swap(Chars[a], Chars[b])
 
+	return int(a), int(b)
+}
+
+// Swap exchanges the keys of ca and cb without updating the score.
+func (kb *Keyboard) Swap(ca, cb byte) {
 	kpa := kb.keyPositionLookup[ca] // {0, 3}
 	kpb := kb.keyPositionLookup[cb] // {1, 3}
 
 	kb.layout[kpa.i][kpa.j], kb.layout[kpb.i][kpb.j] = kb.layout[kpb.i][kpb.j], kb.layout[kpa.i][kpa.j]
 	kb.keyPositionLookup[ca], kb.keyPositionLookup[cb] = kb.keyPositionLookup[cb], kb.keyPositionLookup[ca]
-
-	return int(a), int(b)
 }
 
 func (kb *Keyboard) DetailString() string {
@@ -310,85 +255,84 @@ func (kb *Keyboard) DetailString() string {
 
 func (kb *Keyboard) ScoreString() string {
 	score := kb.Score()
-	perc := func(v int64, mul float64) float64 {
-		return float64(v) * mul / score * 100
+	w := ScoreProfile.Weights
+	var str strings.Builder
+	fmt.Fprintf(&str, "\n    Score:                  %.0f\n", score)
+	for _, r := range registry {
+		v := kb.value(r)
+		label := r.Label() + ":"
+		if r.factor {
+			fmt.Fprintf(&str, "    %-23v %.3f     %.3f\n", label, v*w[r.Name()], v)
+		} else {
+			fmt.Fprintf(&str, "    %-22v %5.1f%%     %.0f\n", label, v*w[r.Name()]/score*100, v)
+		}
 	}
-	return fmt.Sprintf(`
-    Score:                  %.0f
-    Repeated Finger 0 Gap: %5.1f%%     %v
-    Repeated Finger 1 Gap: %5.1f%%     %v
-    Comfortableness:       %5.1f%%     %v
-    Comfy Inward Rolls:    %5.1f%%    %.0v
-    Other Inward Rolls:    %5.1f%%    %.0v
-    Comfy Outward Rolls:   %5.1f%%    %.0v
-    Other Outward Rolls:   %5.1f%%    %.0v
-    Hand Overuse:          %5.1f%%     %.0v
-    Rowjumps:              %5.1f%%     %.0v
-    Distance:              %5.1f%%     %.0f
-    Hand Inequality:        %.3f     %.3f
-    Finger Inequality:      %.3f     %.3f
-
+	str.WriteString("\n    Trigrams:")
+	for _, t := range []struct{ name, label string }{
+		{WeightAlternation, "Alternate"},
+		{WeightTrigramInroll, "Inroll"},
+		{WeightTrigramOutroll, "Outroll"},
+		{WeightOneHandRoll, "One Hand"},
+		{WeightRedirect, "Redirect"},
+		{WeightBadRedirect, "Bad Redirect"},
+	} {
+		if r := lookupMetric(t.name); nil != r && kb.length > 0 {
+			fmt.Fprintf(&str, "  %v %.1f%%", t.label, kb.value(r)/float64(kb.length)*100)
+		}
+	}
+	str.WriteByte('\n')
+	if r := lookupMetric(WeightSameFingerSkipgram); nil != r {
+		str.WriteString("    Skipgrams:")
+		for _, v := range (sameFingerSkipgram{}).fingers(kb.acc[r.offset : r.offset+r.size]) {
+			fmt.Fprintf(&str, " %.0f", v)
+		}
+		str.WriteByte('\n')
+	}
+	fingers, hands := kb.usage()
+	fmt.Fprintf(&str, `
     Left:     %4.1f               Right:   %4.1f
     %4.1f %4.1f %4.1f %4.1f %4.1f    %4.1f %4.1f %4.1f %4.1f %4.1f
 
 
 `,
-		score,
-		perc(kb.repeatedPresses*2, 1),
-		kb.repeatedPresses,
-		perc(kb.repeatFinger1Gap, 1),
-		kb.repeatFinger1Gap,
-		perc(kb.effort, 0.04),
-		kb.effort,
-		perc(-kb.comfyInward, 1),
-		-kb.comfyInward,
-		perc(-kb.inward, 0.25),
-		-kb.inward,
-		perc(-kb.comfyOutward, 0.5),
-		-kb.comfyOutward,
-		perc(-kb.outward, 0.125),
-		-kb.outward,
-		perc(kb.handOverUse, 0.5),
-		kb.handOverUse,
-		perc(kb.rowjump, 0),
-		kb.rowjump,
-		kb.distance*0.25*100/score,
-		kb.distance,
-		kb.handInequality,
-		kb.handInequality,
-		kb.fingerInequality*0.25,
-		kb.fingerInequality,
-		kb.hands[0]*100,
-		kb.hands[1]*100,
-		kb.fingers[0]*100,
-		kb.fingers[1]*100,
-		kb.fingers[2]*100,
-		kb.fingers[3]*100,
-		kb.fingers[4]*100,
-		kb.fingers[5]*100,
-		kb.fingers[6]*100,
-		kb.fingers[7]*100,
-		kb.fingers[8]*100,
-		kb.fingers[9]*100,
+		hands[0]*100,
+		hands[1]*100,
+		fingers[0]*100,
+		fingers[1]*100,
+		fingers[2]*100,
+		fingers[3]*100,
+		fingers[4]*100,
+		fingers[5]*100,
+		fingers[6]*100,
+		fingers[7]*100,
+		fingers[8]*100,
+		fingers[9]*100,
 	)
+	return str.String()
 }
 
 func (kb *Keyboard) String() string {
+	g := kb.geometry
 	var str strings.Builder
 	for i, row := range kb.layout {
 		str.WriteString("    ")
 		for j, ch := range row {
-			switch reserved[i][j] {
-			case 'x':
-				color, ok := effortColor[effort[i][j]]
+			switch {
+			case !g.present[i][j]:
+				str.WriteByte(' ')
+			case g.reserved[i][j] == "":
+				color, ok := effortColor[g.effort[i][j]]
 				if !ok {
 					log.Println("unable to get effort color for", ch)
 				} else {
 					str.WriteString(color)
 				}
-				if ch == '\n' {
+				switch ch {
+				case '\n':
 					str.WriteRune('↩')
-				} else {
+				case 0:
+					str.WriteByte(' ')
+				default:
 					str.WriteByte(ch)
 				}
 				if ok {
@@ -396,13 +340,7 @@ func (kb *Keyboard) String() string {
 				}
 			default:
 				str.WriteString(grey)
-				r, ok := keyPrintingMap[ch]
-				if !ok {
-					log.Println(ch, "not mapped")
-					str.WriteByte(' ')
-				} else {
-					str.WriteRune(r)
-				}
+				str.WriteString(g.reserved[i][j])
 				str.WriteString(reset)
 			}
 			str.WriteString("  ")
@@ -1,14 +1,28 @@
 package keyboard
 
 import (
+	"io/ioutil"
+	"math"
+	prand "math/rand"
+	"strings"
+	"sync"
 	"testing"
 )
 
+const testChars = " etaoinshrl\nduymwgcp.fbkv,?jxz-:q*/"
+
+const testBook = `The quick brown fox jumps over the lazy dog.
+Is it? Yes: it is, a fox - and a *very* quick one/two.
+Hello world, how are you doing today?
+`
+
 func NewTestKeyboard() *Keyboard {
+	Chars = []byte(testChars)
 	kb := &Keyboard{}
-	kb.layout = [4][12]byte{}
+	kb.geometry = DefaultGeometry()
+	kb.layout = newLayout(kb.geometry)
 	kb.keyPositionLookup = [128]KeyPosition{}
-	kb.Fill(0)
+	kb.Fill(prand.New(prand.NewSource(0)))
 	return kb
 }
 
@@ -22,6 +36,132 @@ func NewTestKeyboard() *Keyboard {
 	}
 }*/
 
+func TestConcurrentFillScore(t *testing.T) {
+	kb := NewTestKeyboard()
+	book := strings.Repeat(testBook, 50)
+	kb.Book = &book
+
+	kb.FillScore(&ScoreState{})
+	want := kb.Score()
+
+	var wg sync.WaitGroup
+	scores := make([]float64, 32)
+	for i := range scores {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ckb := kb.Copy()
+			ckb.Book = &book
+			state := &ScoreState{}
+			for j := 0; j < 10; j++ {
+				ckb.FillScore(state)
+			}
+			scores[i] = ckb.Score()
+		}(i)
+	}
+	wg.Wait()
+
+	for i, score := range scores {
+		if score != want {
+			t.Errorf("goroutine %d scored %f but expected %f", i, score, want)
+		}
+	}
+}
+
+func TestFillScoreExact(t *testing.T) {
+	kb := NewTestKeyboard()
+	g := kb.geometry
+
+	// A finger travels from its home key to x and back for every press.
+	var x, home byte
+	for _, c := range Chars {
+		p := kb.keyPositionLookup[c]
+		f := g.absFinger[p.i][p.j]
+		if h := kb.layout[g.home[f].i][g.home[f].j]; p != g.home[f] && h != 0 {
+			x, home = c, h
+			break
+		}
+	}
+	book := string([]byte{x, home, x})
+	kb.Book = &book
+	kb.FillScore(&ScoreState{})
+	p := kb.keyPositionLookup[x]
+	want := 3 * g.distance(p, g.home[g.absFinger[p.i][p.j]])
+	if got := kb.value(lookupMetric(WeightDistance)); got != want {
+		t.Errorf("expected a distance of %v for %q but got %v", want, book, got)
+	}
+
+	// An inroll, a key of the other hand and then an outroll overuse the
+	// hand, even though no trigram holds both rolls.
+	space := kb.keyPositionLookup[' ']
+	for _, a := range Chars {
+		for _, b := range Chars {
+			for _, c := range Chars {
+				pa, pb, pc := kb.keyPositionLookup[a], kb.keyPositionLookup[b], kb.keyPositionLookup[c]
+				if g.transition(space, pc) != crossHand || g.transition(pc, pa) != crossHand ||
+					g.transition(pa, pb) != inroll || g.transition(pb, pc) != crossHand ||
+					g.transition(pb, pa) != outroll {
+					continue
+				}
+				book := string([]byte{c, a, b, c, b, a})
+				kb.Book = &book
+				kb.FillScore(&ScoreState{})
+				if got := kb.value(lookupMetric(WeightHandOverUse)); got != 1 {
+					t.Errorf("expected %q to overuse the hand once but got %v", book, got)
+				}
+				return
+			}
+		}
+	}
+	t.Fatal("no keys roll in and out on one hand")
+}
+
+// TestFillScoreGolden checks FillScore against the values the original
+// byte-walk scorer gave for a layout on messages.txt.
+func TestFillScoreGolden(t *testing.T) {
+	data, err := ioutil.ReadFile("../messages.txt")
+	if nil != err {
+		t.Fatal(err)
+	}
+	book := string(data)
+	kb, err := NewFromGenome(DefaultGeometry(), []byte("mzr:w?,loy-tkjbpu .xdncqsavgi/\nefh*"))
+	if nil != err {
+		t.Fatal(err)
+	}
+	kb.Book = &book
+	kb.FillScore(&ScoreState{})
+
+	for _, c := range []struct {
+		name string
+		want float64
+	}{
+		{WeightRepeatedPresses, 187808},
+		{WeightRepeatFinger1Gap, 204069},
+		{WeightEffort, 3776215},
+		{WeightHandOverUse, 402216},
+		{WeightDistance, 1320511.1169},
+	} {
+		if got := kb.value(lookupMetric(c.name)); math.Abs(got-c.want) > 1e-4 {
+			t.Errorf("expected %v to be %v but got %v", c.name, c.want, got)
+		}
+	}
+	if got, want := kb.Score(), 1291570.2225; math.Abs(got-want) > 1e-4 {
+		t.Errorf("expected a score of %v but got %v", want, got)
+	}
+}
+
+func TestNewSeeded(t *testing.T) {
+	NewTestKeyboard()
+	g := DefaultGeometry()
+	a := New(g, prand.New(prand.NewSource(42)))
+	b := New(g, prand.New(prand.NewSource(42)))
+	a.Mutate(prand.New(prand.NewSource(7)))
+	b.Mutate(prand.New(prand.NewSource(7)))
+	if a.String() != b.String() {
+		t.Errorf("the same seed produced different layouts\n%v\n%v", a, b)
+	}
+}
+
 func TestMutate(t *testing.T) {
 	kb := NewTestKeyboard()
 
@@ -34,14 +174,14 @@ func TestMutate(t *testing.T) {
 	kb := NewTestKeyboard()
 
 	for i := 0; i < b.N; i++ {
-		kb.Mutate()
+		kb.Mutate(r)
 	}
 }*/
 
 func _testMutate(t *testing.T, kb *Keyboard) {
 	// Do the mutation
 	okb := kb.Copy()
-	x, y := kb.Mutate()
+	x, y := kb.Mutate(prand.New(prand.NewSource(0)))
 	t.Logf("\n%v", okb)
 	t.Logf("\n%v", kb)
 
@@ -0,0 +1,375 @@
+package keyboard
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sync"
+)
+
+// Metric measures one aspect of a layout from the n-grams it types. A metric
+// keeps one or more running sums that Observe adds to and Value turns into
+// the metric. Observe must be linear in count, so that an n-gram can be
+// removed again by observing it with a negative count when keys are swapped.
+type Metric interface {
+	// Name identifies the metric and its weight in a Profile.
+	Name() string
+	// Label is how reports show the metric.
+	Label() string
+	// Order is the length of the n-grams the metric observes, 1 to 3.
+	Order() int
+	// Accumulators is the number of sums the metric keeps.
+	Accumulators() int
+	// Observe adds count occurrences of an n-gram to acc. The n-gram is typed
+	// on keys[0:Order()], oldest key first.
+	Observe(g *Geometry, keys [3]KeyPosition, count int64, acc []float64)
+	// Value computes the metric from its sums for a corpus of the given
+	// length.
+	Value(acc []float64, length int64) float64
+}
+
+// SkipgramMetric is a metric that also observes pairs of keys typed with 1 to
+// 3 other keys between them.
+type SkipgramMetric interface {
+	Metric
+	// ObserveSkipgram adds count occurrences of a typed on a, then gap other
+	// keys, then b, to acc.
+	ObserveSkipgram(g *Geometry, a, b KeyPosition, gap int, count int64, acc []float64)
+}
+
+// SequenceMetric is a metric that carries state from one key press to the
+// next, such as where each finger rests. FillScore measures it by walking the
+// book through a SequenceState, while FillScoreNGrams only has Observe, which
+// estimates the metric from n-grams.
+type SequenceMetric interface {
+	Metric
+	// NewState returns a state for FillScore to walk a book with.
+	NewState() SequenceState
+}
+
+// SequenceState is what a SequenceMetric remembers between key presses.
+type SequenceState interface {
+	// Reset returns the state to the start of a book typed on g.
+	Reset(g *Geometry)
+	// Press adds the press of b, which follows a press of a, to acc.
+	Press(g *Geometry, a, b KeyPosition, acc []float64)
+}
+
+type registration struct {
+	Metric
+	// factor metrics scale the score by 1 + weight * value instead of adding
+	// weight * value to it.
+	factor bool
+	offset int
+	size   int
+}
+
+var registry = []*registration{}
+
+// byOrder holds the registered metrics by the order of n-gram they observe.
+var byOrder [4][]*registration
+
+// sequences holds the registered metrics that are SequenceMetrics.
+var sequences []*registration
+
+// accumulators is the total number of sums of the registered metrics.
+var accumulators int
+
+// Register adds a metric that contributes weight * value to the score, with
+// its weight taken from ScoreProfile. Metrics must be registered before any
+// keyboard is scored.
+func Register(m Metric) {
+	register(m, false)
+}
+
+// RegisterFactor adds a metric that scales the score by 1 + weight * value.
+func RegisterFactor(m Metric) {
+	register(m, true)
+}
+
+func register(m Metric, factor bool) {
+	if m.Order() < 1 || m.Order() > 3 {
+		panic(fmt.Sprintf("metric %v observes n-grams of order %d, want 1-3", m.Name(), m.Order()))
+	}
+	if nil != lookupMetric(m.Name()) {
+		panic(fmt.Sprintf("metric %v is registered twice", m.Name()))
+	}
+	r := &registration{Metric: m, factor: factor, offset: accumulators, size: m.Accumulators()}
+	registry = append(registry, r)
+	byOrder[m.Order()] = append(byOrder[m.Order()], r)
+	if _, ok := m.(SequenceMetric); ok {
+		sequences = append(sequences, r)
+	}
+	accumulators += r.size
+
+	tablesMutex.Lock()
+	tablesCache = map[*Geometry]*metricTables{}
+	tablesMutex.Unlock()
+}
+
+func lookupMetric(name string) *registration {
+	for _, r := range registry {
+		if r.Name() == name {
+			return r
+		}
+	}
+	return nil
+}
+
+// Metrics lists the registered metrics in the order they are reported.
+func Metrics() []Metric {
+	metrics := make([]Metric, len(registry))
+	for i, r := range registry {
+		metrics[i] = r.Metric
+	}
+	return metrics
+}
+
+type linearMetric struct {
+	name, label string
+	order       int
+	observe     func(g *Geometry, keys [3]KeyPosition) float64
+}
+
+// NewMetric returns a metric whose value is the sum of observe over every
+// n-gram of the corpus.
+func NewMetric(name, label string, order int, observe func(g *Geometry, keys [3]KeyPosition) float64) Metric {
+	return &linearMetric{name, label, order, observe}
+}
+
+func (m *linearMetric) Name() string      { return m.name }
+func (m *linearMetric) Label() string     { return m.label }
+func (m *linearMetric) Order() int        { return m.order }
+func (m *linearMetric) Accumulators() int { return 1 }
+
+func (m *linearMetric) Observe(g *Geometry, keys [3]KeyPosition, count int64, acc []float64) {
+	if v := m.observe(g, keys); v != 0 {
+		acc[0] += v * float64(count)
+	}
+}
+
+func (m *linearMetric) Value(acc []float64, length int64) float64 {
+	return acc[0]
+}
+
+type sequenceMetric struct {
+	linearMetric
+	newState func() SequenceState
+}
+
+// NewSequenceMetric returns a SequenceMetric whose value FillScore sums with
+// the states newState returns, and FillScoreNGrams estimates as the sum of
+// observe over every n-gram of the corpus.
+func NewSequenceMetric(name, label string, order int, observe func(g *Geometry, keys [3]KeyPosition) float64, newState func() SequenceState) Metric {
+	return &sequenceMetric{linearMetric{name, label, order, observe}, newState}
+}
+
+func (m *sequenceMetric) NewState() SequenceState { return m.newState() }
+
+// scores holds the sums of every registered metric for a keyboard.
+type scores struct {
+	acc    []float64
+	length int64
+}
+
+func (s *scores) reset(length int64) {
+	if len(s.acc) != accumulators {
+		s.acc = make([]float64, accumulators)
+	}
+	for i := range s.acc {
+		s.acc[i] = 0
+	}
+	s.length = length
+}
+
+func (s scores) copy() scores {
+	acc := make([]float64, len(s.acc))
+	copy(acc, s.acc)
+	return scores{acc, s.length}
+}
+
+// observe adds count occurrences of the n-gram with the given index in t.
+func (s *scores) observe(t *table, index int, count int64) {
+	c := float64(count)
+	for _, e := range t.entries[t.start[index]:t.start[index+1]] {
+		s.acc[e.acc] += e.value * c
+	}
+}
+
+// press adds one occurrence of the n-gram with the given index in t to the
+// metrics that are not SequenceMetrics.
+func (s *scores) press(t *table, index int) {
+	for _, e := range t.entries[t.start[index]:t.walk[index]] {
+		s.acc[e.acc] += e.value
+	}
+}
+
+func (s *scores) value(r *registration) float64 {
+	return r.Value(s.acc[r.offset:r.offset+r.size], s.length)
+}
+
+func (s *scores) score() float64 {
+	w := ScoreProfile.Weights
+	sum, factor := 0.0, 1.0
+	for _, r := range registry {
+		v := s.value(r) * w[r.Name()]
+		if r.factor {
+			factor += v
+		} else {
+			sum += v
+		}
+	}
+	return 100000 + sum*factor
+}
+
+// metricTables hold what every registered metric adds to the sums for each
+// n-gram of keys of a geometry, so that scoring a layout only looks them up.
+// Keys are numbered by Geometry.index and an n-gram's index in the table of
+// its order is its keys in base rows * cols.
+type metricTables struct {
+	orders    [4]table
+	skipgrams [maxGap + 1]table
+}
+
+type table struct {
+	// The contributions of the n-gram with index i are
+	// entries[start[i]:start[i+1]].
+	start   []int32
+	entries []contribution
+	// The contributions of SequenceMetrics come last, from walk[i].
+	walk []int32
+	// n-grams with the same class have the same contributions.
+	class []int32
+}
+
+// classify numbers the distinct contributions of the n-grams of t.
+func (t *table) classify() {
+	t.class = make([]int32, len(t.start)-1)
+	classes := map[string]int32{}
+	key, buf := []byte{}, make([]byte, 12)
+	for i := range t.class {
+		key = key[:0]
+		for _, e := range t.entries[t.start[i]:t.start[i+1]] {
+			binary.LittleEndian.PutUint32(buf, uint32(e.acc))
+			binary.LittleEndian.PutUint64(buf[4:], math.Float64bits(e.value))
+			key = append(key, buf...)
+		}
+		c, ok := classes[string(key)]
+		if !ok {
+			c = int32(len(classes))
+			classes[string(key)] = c
+		}
+		t.class[i] = c
+	}
+}
+
+type contribution struct {
+	acc   int32
+	value float64
+}
+
+var tablesMutex sync.RWMutex
+var tablesCache = map[*Geometry]*metricTables{}
+
+func tablesFor(g *Geometry) *metricTables {
+	tablesMutex.RLock()
+	t, ok := tablesCache[g]
+	tablesMutex.RUnlock()
+	if ok {
+		return t
+	}
+	tablesMutex.Lock()
+	defer tablesMutex.Unlock()
+	if t, ok = tablesCache[g]; !ok {
+		t = newMetricTables(g)
+		tablesCache[g] = t
+	}
+	return t
+}
+
+func (g *Geometry) bigram(a, b KeyPosition) int {
+	return g.index(a)*g.rows*g.cols + g.index(b)
+}
+
+func (g *Geometry) trigram(z, a, b KeyPosition) int {
+	n := g.rows * g.cols
+	return (g.index(z)*n+g.index(a))*n + g.index(b)
+}
+
+func newMetricTables(g *Geometry) *metricTables {
+	n := g.rows * g.cols
+	position := func(k int) KeyPosition {
+		return KeyPosition{k / g.cols, k % g.cols}
+	}
+	acc := make([]float64, accumulators)
+	t := &metricTables{}
+	for order := 1; order <= 3; order++ {
+		size := n
+		for i := 1; i < order; i++ {
+			size *= n
+		}
+		tab := table{start: make([]int32, size+1), walk: make([]int32, size)}
+		for index := 0; index < size; index++ {
+			keys := [3]KeyPosition{}
+			for i, k := order-1, index; i >= 0; i, k = i-1, k/n {
+				keys[i] = position(k % n)
+			}
+			for _, sequence := range []bool{false, true} {
+				tab.walk[index] = int32(len(tab.entries))
+				for _, r := range byOrder[order] {
+					if _, ok := r.Metric.(SequenceMetric); ok != sequence {
+						continue
+					}
+					sums := acc[r.offset : r.offset+r.size]
+					r.Observe(g, keys, 1, sums)
+					for i, v := range sums {
+						if v != 0 {
+							tab.entries = append(tab.entries, contribution{int32(r.offset + i), v})
+							sums[i] = 0
+						}
+					}
+				}
+			}
+			tab.start[index+1] = int32(len(tab.entries))
+		}
+		tab.classify()
+		t.orders[order] = tab
+	}
+	for gap := 1; gap <= maxGap; gap++ {
+		tab := table{start: make([]int32, n*n+1)}
+		for index := 0; index < n*n; index++ {
+			a, b := position(index/n), position(index%n)
+			for _, r := range registry {
+				m, ok := r.Metric.(SkipgramMetric)
+				if !ok {
+					continue
+				}
+				sums := acc[r.offset : r.offset+r.size]
+				m.ObserveSkipgram(g, a, b, gap, 1, sums)
+				for i, v := range sums {
+					if v != 0 {
+						tab.entries = append(tab.entries, contribution{int32(r.offset + i), v})
+						sums[i] = 0
+					}
+				}
+			}
+			tab.start[index+1] = int32(len(tab.entries))
+		}
+		tab.classify()
+		t.skipgrams[gap] = tab
+	}
+	return t
+}
+
+// usage returns the share of key presses made by each finger and each hand.
+func (s *scores) usage() (fingers [10]float64, hands [2]float64) {
+	r := lookupMetric(WeightFingerInequality)
+	if nil == r || s.length == 0 {
+		return
+	}
+	for f, count := range s.acc[r.offset : r.offset+10] {
+		fingers[f] = count / float64(s.length)
+		hands[f/5] += fingers[f]
+	}
+	return
+}
@@ -0,0 +1,220 @@
+package keyboard
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestRegister(t *testing.T) {
+	// Leave the registry as the other tests expect it.
+	defer func(r []*registration, o [4][]*registration, q []*registration, n int) {
+		registry, byOrder, sequences, accumulators = r, o, q, n
+		tablesMutex.Lock()
+		tablesCache = map[*Geometry]*metricTables{}
+		tablesMutex.Unlock()
+	}(registry, byOrder, sequences, accumulators)
+
+	Register(NewMetric("testSameHand", "Same Hand", 2, func(g *Geometry, k [3]KeyPosition) float64 {
+		if g.Key(k[0]).Hand == g.Key(k[1]).Hand {
+			return 1
+		}
+		return 0
+	}))
+
+	kb := NewTestKeyboard()
+	book := strings.Repeat(testBook, 5)
+	kb.Book = &book
+	kb.FillScore(&ScoreState{})
+
+	expected := 0.0
+	g := kb.geometry
+	prev := kb.keyPositionLookup[' ']
+	for _, c := range []byte(book) {
+		p := kb.keyPositionLookup[c]
+		if g.Key(prev).Hand == g.Key(p).Hand {
+			expected++
+		}
+		prev = p
+	}
+	if got := kb.value(lookupMetric("testSameHand")); got != expected {
+		t.Errorf("expected %v same hand bigrams but got %v", expected, got)
+	}
+
+	var err error
+	kb.Corpus, err = NewCorpus(book)
+	if nil != err {
+		t.Fatal(err)
+	}
+	kb.FillScoreNGrams()
+	if got := kb.value(lookupMetric("testSameHand")); got != expected {
+		t.Errorf("expected %v same hand bigrams from the corpus but got %v", expected, got)
+	}
+	if !strings.Contains(kb.ScoreString(), "Same Hand") {
+		t.Errorf("expected the metric in the score breakdown")
+	}
+}
+
+// handRepeats counts presses of the key its hand pressed last, however many
+// keys the other hand pressed in between.
+type handRepeats struct {
+	last [2]KeyPosition
+}
+
+func (s *handRepeats) Reset(g *Geometry) {
+	s.last = [2]KeyPosition{{-1, -1}, {-1, -1}}
+}
+
+func (s *handRepeats) Press(g *Geometry, a, b KeyPosition, acc []float64) {
+	h := g.hand[b.i][b.j]
+	if s.last[h] == b {
+		acc[0]++
+	}
+	s.last[h] = b
+}
+
+func TestRegisterSequence(t *testing.T) {
+	defer func(r []*registration, o [4][]*registration, q []*registration, n int) {
+		registry, byOrder, sequences, accumulators = r, o, q, n
+		tablesMutex.Lock()
+		tablesCache = map[*Geometry]*metricTables{}
+		tablesMutex.Unlock()
+	}(registry, byOrder, sequences, accumulators)
+
+	Register(NewSequenceMetric("testHandRepeats", "Hand Repeats", 2, func(g *Geometry, k [3]KeyPosition) float64 {
+		if k[0] == k[1] {
+			return 1
+		}
+		return 0
+	}, func() SequenceState { return &handRepeats{} }))
+
+	kb := NewTestKeyboard()
+	book := strings.Repeat(testBook, 5)
+	kb.Book = &book
+	kb.FillScore(&ScoreState{})
+
+	expected := 0.0
+	g := kb.geometry
+	last := [2]byte{}
+	for _, c := range []byte(book) {
+		p := kb.keyPositionLookup[c]
+		h := g.hand[p.i][p.j]
+		if last[h] != 0 && kb.keyPositionLookup[last[h]] == p {
+			expected++
+		}
+		last[h] = c
+	}
+	if got := kb.value(lookupMetric("testHandRepeats")); got != expected {
+		t.Errorf("expected %v hand repeats but got %v", expected, got)
+	}
+}
+
+func TestLateralStretch(t *testing.T) {
+	g := DefaultGeometry()
+	for _, c := range []struct {
+		a, b KeyPosition
+		want float64
+	}{
+		{KeyPosition{1, 5}, KeyPosition{1, 3}, 1},  // left index inner column, then middle
+		{KeyPosition{1, 10}, KeyPosition{0, 6}, 0}, // right pinky, then right index inner column
+		{KeyPosition{1, 0}, KeyPosition{1, 2}, 1},  // left pinky outer column, then ring
+		{KeyPosition{1, 0}, KeyPosition{1, 3}, 0},  // pinky, then middle
+		{KeyPosition{1, 4}, KeyPosition{1, 3}, 0},  // index on its home column
+		{KeyPosition{1, 6}, KeyPosition{1, 8}, 1},  // right index inner column, then middle
+		{KeyPosition{1, 5}, KeyPosition{1, 6}, 0},  // different hands
+	} {
+		if got := lateralStretch(g, [3]KeyPosition{c.a, c.b}); got != c.want {
+			t.Errorf("%v to %v: expected %v but got %v", c.a, c.b, c.want, got)
+		}
+	}
+}
+
+func TestScissor(t *testing.T) {
+	g := DefaultGeometry()
+	full, half := scissor(true), scissor(false)
+	for _, c := range []struct {
+		a, b       KeyPosition
+		full, half float64
+	}{
+		{KeyPosition{0, 2}, KeyPosition{2, 3}, 1.25, 0}, // left ring top, middle bottom
+		{KeyPosition{2, 1}, KeyPosition{0, 2}, 1.5, 0},  // left pinky bottom, ring top
+		{KeyPosition{0, 2}, KeyPosition{1, 3}, 0, 1.25}, // left ring above middle
+		{KeyPosition{1, 2}, KeyPosition{0, 3}, 0, 0},    // left middle above ring
+		{KeyPosition{0, 3}, KeyPosition{2, 3}, 0, 0},    // same finger
+		{KeyPosition{0, 4}, KeyPosition{2, 7}, 0, 0},    // different hands
+	} {
+		k := [3]KeyPosition{c.a, c.b}
+		if got := full(g, k); got != c.full {
+			t.Errorf("%v to %v: expected a full scissor of %v but got %v", c.a, c.b, c.full, got)
+		}
+		if got := half(g, k); got != c.half {
+			t.Errorf("%v to %v: expected a half scissor of %v but got %v", c.a, c.b, c.half, got)
+		}
+	}
+}
+
+func TestClassifyTrigram(t *testing.T) {
+	g := DefaultGeometry()
+	for _, c := range []struct {
+		z, a, b KeyPosition
+		want    int
+	}{
+		{KeyPosition{1, 1}, KeyPosition{1, 7}, KeyPosition{1, 2}, alternate},
+		{KeyPosition{1, 1}, KeyPosition{1, 3}, KeyPosition{1, 8}, trigramInroll},
+		{KeyPosition{1, 8}, KeyPosition{1, 4}, KeyPosition{1, 3}, trigramOutroll},
+		{KeyPosition{1, 1}, KeyPosition{1, 2}, KeyPosition{1, 3}, oneHandRoll},
+		{KeyPosition{1, 2}, KeyPosition{1, 4}, KeyPosition{1, 3}, redirect},
+		{KeyPosition{1, 1}, KeyPosition{1, 3}, KeyPosition{1, 2}, badRedirect},
+		{KeyPosition{1, 3}, KeyPosition{0, 3}, KeyPosition{1, 8}, unclassified},
+	} {
+		if got := g.classifyTrigram(c.z, c.a, c.b); got != c.want {
+			t.Errorf("%v %v %v: expected class %d but got %d", c.z, c.a, c.b, c.want, got)
+		}
+	}
+}
+
+func TestSameFingerSkipgram(t *testing.T) {
+	kb := NewTestKeyboard()
+	kb.Corpus, _ = NewCorpus(testBook)
+	kb.FillScoreNGrams()
+	g := kb.geometry
+	r := lookupMetric(WeightSameFingerSkipgram)
+
+	defer func() { ScoreProfile = DefaultProfile() }()
+	for _, c := range []struct {
+		gaps      int
+		decay     float64
+		otherHand float64
+	}{{3, 0.5, 0.5}, {1, 0.5, 1}, {2, 1, 0}, {0, 1, 0.5}} {
+		ScoreProfile.SkipgramGaps, ScoreProfile.SkipgramDecay, ScoreProfile.SkipgramOtherHand = c.gaps, c.decay, c.otherHand
+		want := [10]float64{}
+		book := []byte(testBook)
+		for i, b := range book {
+			weight := 1.0
+			for gap := 1; gap <= c.gaps; gap++ {
+				a, middle := byte(' '), byte(' ')
+				if i > gap {
+					a = book[i-gap-1]
+				}
+				if i > 0 {
+					middle = book[i-1]
+				}
+				ka, kb, km := kb.keyPositionLookup[a], kb.keyPositionLookup[b], kb.keyPositionLookup[middle]
+				if f := g.absFinger[ka.i][ka.j]; f == g.absFinger[kb.i][kb.j] {
+					if gap == 1 && g.hand[km.i][km.j] != g.hand[kb.i][kb.j] {
+						want[f] += g.distance(ka, kb) * weight * c.otherHand
+					} else {
+						want[f] += g.distance(ka, kb) * weight
+					}
+				}
+				weight *= c.decay
+			}
+		}
+		got := (sameFingerSkipgram{}).fingers(kb.acc[r.offset : r.offset+r.size])
+		for f := range want {
+			if math.Abs(got[f]-want[f]) > 1e-9 {
+				t.Errorf("%+v: expected finger %d to travel %v but got %v", c, f, want[f], got[f])
+			}
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package keyboard
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+)
+
+// Names of the weights of a Profile. Each weight multiplies the metric of the
+// same name, except for the inequalities, which scale the whole score by
+// 1 + weight * inequality. Rolls are rewarded, so their weights are negative.
+const (
+	WeightDistance           = "distance"
+	WeightRepeatedPresses    = "repeatedPresses"
+	WeightRepeatFinger1Gap   = "repeatFinger1Gap"
+	WeightEffort             = "effort"
+	WeightComfyInward        = "comfyInward"
+	WeightInward             = "inward"
+	WeightComfyOutward       = "comfyOutward"
+	WeightOutward            = "outward"
+	WeightHandOverUse        = "handOverUse"
+	WeightRowjump            = "rowjump"
+	WeightLateralStretch     = "lateralStretch"
+	WeightFullScissor        = "fullScissor"
+	WeightHalfScissor        = "halfScissor"
+	WeightAlternation        = "alternation"
+	WeightTrigramInroll      = "trigramInroll"
+	WeightTrigramOutroll     = "trigramOutroll"
+	WeightOneHandRoll        = "oneHandRoll"
+	WeightRedirect           = "redirect"
+	WeightBadRedirect        = "badRedirect"
+	WeightSameFingerSkipgram = "sameFingerSkipgram"
+	WeightHandInequality     = "handInequality"
+	WeightFingerInequality   = "fingerInequality"
+)
+
+// Profile is a set of scoring weights. SkipgramGaps is the longest gap, up to
+// 3 keys, that same finger skipgrams are counted for, and a skipgram with a gap
+// of n keys is weighed by SkipgramDecay^(n-1). A skipgram with a gap of one
+// key typed by the other hand is also weighed by SkipgramOtherHand, as the
+// finger can move while the other hand types.
+type Profile struct {
+	Name              string             `json:"name"`
+	SkipgramGaps      int                `json:"skipgramGaps"`
+	SkipgramDecay     float64            `json:"skipgramDecay"`
+	SkipgramOtherHand float64            `json:"skipgramOtherHand"`
+	Weights           map[string]float64 `json:"weights"`
+}
+
+const (
+	defaultSkipgramGaps      = 3
+	defaultSkipgramDecay     = 0.5
+	defaultSkipgramOtherHand = 0.5
+)
+
+// ScoreProfile is the profile Score and ScoreString weigh the metrics with.
+var ScoreProfile = DefaultProfile()
+
+var defaultWeights = map[string]float64{
+	WeightDistance:           0.25,
+	WeightRepeatedPresses:    2,
+	WeightRepeatFinger1Gap:   1,
+	WeightEffort:             0.04,
+	WeightComfyInward:        -1,
+	WeightInward:             -0.25,
+	WeightComfyOutward:       -0.5,
+	WeightOutward:            -0.125,
+	WeightHandOverUse:        0.5,
+	WeightRowjump:            0,
+	WeightLateralStretch:     0,
+	WeightFullScissor:        0,
+	WeightHalfScissor:        0,
+	WeightAlternation:        0,
+	WeightTrigramInroll:      0,
+	WeightTrigramOutroll:     0,
+	WeightOneHandRoll:        0,
+	WeightRedirect:           0,
+	WeightBadRedirect:        0,
+	WeightSameFingerSkipgram: 0,
+	WeightHandInequality:     0,
+	WeightFingerInequality:   0.25,
+}
+
+// profiles are the bundled profiles, given as changes to the default weights.
+var profiles = map[string]map[string]float64{
+	"default": {},
+	"low-sfb": {
+		WeightRepeatedPresses:    6,
+		WeightRepeatFinger1Gap:   3,
+		WeightSameFingerSkipgram: 1,
+	},
+	"roll-heavy": {
+		WeightComfyInward:  -3,
+		WeightInward:       -0.75,
+		WeightComfyOutward: -1.5,
+		WeightOutward:      -0.375,
+	},
+	"ergonomic-distance": {
+		WeightDistance: 1,
+		WeightEffort:   0.1,
+		WeightRowjump:  1,
+	},
+}
+
+func DefaultProfile() *Profile {
+	p, _ := BundledProfile("default")
+	return p
+}
+
+// Profiles lists the names of the bundled profiles.
+func Profiles() []string {
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func BundledProfile(name string) (*Profile, error) {
+	changes, ok := profiles[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown profile %v", name)
+	}
+	return newProfile(&Profile{
+		Name:              name,
+		SkipgramGaps:      defaultSkipgramGaps,
+		SkipgramDecay:     defaultSkipgramDecay,
+		SkipgramOtherHand: defaultSkipgramOtherHand,
+	}, changes)
+}
+
+// LoadProfile reads a profile from a JSON file. Weights and skipgram settings
+// that the file does not set keep their default value, which is 0 for
+// registered metrics that are not built in.
+func LoadProfile(path string) (*Profile, error) {
+	data, err := ioutil.ReadFile(path)
+	if nil != err {
+		return nil, err
+	}
+	p := &Profile{
+		SkipgramGaps:      defaultSkipgramGaps,
+		SkipgramDecay:     defaultSkipgramDecay,
+		SkipgramOtherHand: defaultSkipgramOtherHand,
+	}
+	if err := json.Unmarshal(data, p); nil != err {
+		return nil, err
+	}
+	return newProfile(p, p.Weights)
+}
+
+// newProfile returns a profile with the name and skipgram settings of
+// settings and the default weights overridden by changes.
+func newProfile(settings *Profile, changes map[string]float64) (*Profile, error) {
+	if settings.SkipgramGaps < 0 || settings.SkipgramGaps > maxGap {
+		return nil, fmt.Errorf("skipgramGaps must be between 0 and %d", maxGap)
+	}
+	if settings.SkipgramDecay < 0 {
+		return nil, fmt.Errorf("skipgramDecay must not be negative")
+	}
+	if settings.SkipgramOtherHand < 0 {
+		return nil, fmt.Errorf("skipgramOtherHand must not be negative")
+	}
+	p := *settings
+	p.Weights = map[string]float64{}
+	for k, v := range defaultWeights {
+		p.Weights[k] = v
+	}
+	for k, v := range changes {
+		if _, ok := defaultWeights[k]; !ok && nil == lookupMetric(k) {
+			return nil, fmt.Errorf("unknown weight %v", k)
+		}
+		p.Weights[k] = v
+	}
+	return &p, nil
+}
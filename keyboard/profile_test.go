@@ -0,0 +1,48 @@
+package keyboard
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestLoadProfile(t *testing.T) {
+	for _, name := range Profiles() {
+		p, err := LoadProfile("../profiles/" + name + ".json")
+		if nil != err {
+			t.Fatal(err)
+		}
+		bundled, _ := BundledProfile(name)
+		if !reflect.DeepEqual(p, bundled) {
+			t.Errorf("profiles/%v.json does not match the bundled profile", name)
+		}
+	}
+}
+
+func TestProfileScore(t *testing.T) {
+	kb := NewTestKeyboard()
+	kb.Corpus, _ = NewCorpus(testBook)
+	kb.FillScoreNGrams()
+	v := func(name string) float64 {
+		return kb.value(lookupMetric(name))
+	}
+	want := 100000 + (v(WeightDistance)/4+
+		v(WeightRepeatedPresses)*2+
+		v(WeightRepeatFinger1Gap)+
+		v(WeightEffort)*0.04-
+		v(WeightComfyInward)-
+		v(WeightInward)/4-
+		v(WeightComfyOutward)/2-
+		v(WeightOutward)/8+
+		v(WeightHandOverUse)/2)*
+		(1+v(WeightFingerInequality)/4)
+	if score := kb.Score(); math.Abs(score-want) > 1e-6 {
+		t.Errorf("expected the default profile to score %v but got %v", want, score)
+	}
+
+	defer func() { ScoreProfile = DefaultProfile() }()
+	ScoreProfile, _ = BundledProfile("low-sfb")
+	if kb.Score() <= want {
+		t.Errorf("expected low-sfb to penalise same finger bigrams more")
+	}
+}
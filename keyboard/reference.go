@@ -0,0 +1,111 @@
+package keyboard
+
+import (
+	"fmt"
+	"strings"
+)
+
+// references are well known layouts on the default 4x12 geometry. The
+// letters and punctuation of the 3x10 block keep their usual places, space
+// goes on the left thumb and enter on the right pinky.
+var references = []struct {
+	name string
+	grid string
+}{
+	{"QWERTY", `
+· q w e r t y u i o p ·
+· a s d f g h j k l ; ↩
+· z x c v b n m , . / ·
+· · · · · ␣ · · · · · ·
+`},
+	{"Dvorak", `
+· ' , . p y f g c r l /
+· a o e u i d h t n s ↩
+· ; q j k x b m w v z ·
+· · · · · ␣ · · · · · ·
+`},
+	{"Colemak", `
+· q w f p g j l u y ; ·
+· a r s t d h n e i o ↩
+· z x c v b k m , . / ·
+· · · · · ␣ · · · · · ·
+`},
+	{"Colemak-DH", `
+· q w f p b j l u y ; ·
+· a r s t g m n e i o ↩
+· z x c d v k h , . / ·
+· · · · · ␣ · · · · · ·
+`},
+	{"Workman", `
+· q d r w b j f u p ; ·
+· a s h t g y n e o i ↩
+· z x m c v k l , . / ·
+· · · · · ␣ · · · · · ·
+`},
+	{"Halmak", `
+· w l r b z ; q u d j ·
+· s h n t , . a e o i ↩
+· f m v c / g p x k y ·
+· · · · · ␣ · · · · · ·
+`},
+	{"MTGAP", `
+· y p o u j k d l c w ·
+· i n e a , m h t s r ↩
+· q z / . : b f g v x ·
+· · · · · ␣ · · · · · ·
+`},
+}
+
+// References lists the names of the built in reference layouts.
+func References() []string {
+	names := make([]string, len(references))
+	for i, r := range references {
+		names[i] = r.name
+	}
+	return names
+}
+
+// Reference returns the named reference layout, matched without regard to
+// case, adapted to Chars: characters of the layout that are not in Chars are
+// removed, and the characters of Chars that the layout does not place fill the
+// empty free keys in row major order, most frequent first.
+func Reference(g *Geometry, name string) (*Keyboard, error) {
+	for _, r := range references {
+		if !strings.EqualFold(r.name, name) {
+			continue
+		}
+		kb, err := ParseLayout(g, r.grid)
+		if nil != err {
+			return nil, fmt.Errorf("%v: %w", r.name, err)
+		}
+		kb.fitChars()
+		return kb, nil
+	}
+	return nil, fmt.Errorf("unknown reference layout %v", name)
+}
+
+func (kb *Keyboard) fitChars() {
+	want := [128]bool{}
+	for _, c := range Chars {
+		want[c] = true
+	}
+	genome := kb.Genome()
+	placed := [128]bool{}
+	for k, c := range genome {
+		if !want[c] || placed[c] {
+			genome[k] = 0
+		}
+		placed[genome[k]] = true
+	}
+	k := 0
+	for _, c := range Chars {
+		if placed[c] {
+			continue
+		}
+		for genome[k] != 0 {
+			k++
+		}
+		genome[k] = c
+	}
+	kb.SetGenome(genome)
+}
@@ -0,0 +1,24 @@
+package keyboard
+
+import "testing"
+
+func TestReference(t *testing.T) {
+	Chars = []byte(testChars)
+	g := DefaultGeometry()
+	for _, name := range References() {
+		kb, err := Reference(g, name)
+		if nil != err {
+			t.Fatal(err)
+		}
+		if err := kb.Validate(); nil != err {
+			t.Errorf("%v: %v", name, err)
+		}
+	}
+	kb, err := Reference(g, "qwerty")
+	if nil != err {
+		t.Fatal(err)
+	}
+	if p := kb.keyPositionLookup['a']; p != (KeyPosition{1, 1}) {
+		t.Errorf("expected a on the home row of the left pinky but got %v", p)
+	}
+}
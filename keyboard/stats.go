@@ -0,0 +1,90 @@
+package keyboard
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Stat is one named component of a layout's score, as shown by ScoreString.
+type Stat struct {
+	Name  string  `json:"name"`
+	Value float64 `json:"value"`
+}
+
+var fingerNames = [10]string{
+	"Left Pinky", "Left Ring", "Left Middle", "Left Index", "Left Thumb",
+	"Right Thumb", "Right Index", "Right Middle", "Right Ring", "Right Pinky",
+}
+
+// Stats returns the score and every registered metric in the order
+// ScoreString shows them, followed by the share of presses of each hand and
+// finger.
+func (kb *Keyboard) Stats() []Stat {
+	stats := []Stat{{"Score", kb.Score()}}
+	for _, r := range registry {
+		stats = append(stats, Stat{r.Label(), kb.value(r)})
+	}
+	fingers, hands := kb.usage()
+	stats = append(stats, Stat{"Left Hand", hands[0]}, Stat{"Right Hand", hands[1]})
+	for i, name := range fingerNames {
+		stats = append(stats, Stat{name, fingers[i]})
+	}
+	return stats
+}
+
+// FormatStat formats the value of a Stat, with three decimals when it is
+// small and none otherwise.
+func FormatStat(v float64) string {
+	if v != 0 && v > -10 && v < 10 {
+		return fmt.Sprintf("%.3f", v)
+	}
+	return fmt.Sprintf("%.0f", v)
+}
+
+// DiffString compares kb with an older layout scored against the same
+// corpus. It shows every stat of both with the change between them, and the
+// layout of kb with the keys that moved highlighted.
+func (kb *Keyboard) DiffString(old *Keyboard) string {
+	var str strings.Builder
+	str.WriteString("\n    Metric                        Old          New        Delta        %\n")
+	oldStats := old.Stats()
+	for i, stat := range kb.Stats() {
+		from, to := oldStats[i].Value, stat.Value
+		rel := "-"
+		if from != 0 {
+			rel = fmt.Sprintf("%+.1f", (to-from)/from*100)
+		}
+		delta := FormatStat(to - from)
+		if to-from > 0 {
+			delta = "+" + delta
+		}
+		fmt.Fprintf(&str, "    %-22v %12v %12v %12v %8v\n", stat.Name, FormatStat(from), FormatStat(to), delta, rel)
+	}
+
+	moved := []string{}
+	for _, c := range Chars {
+		if p, q := old.keyPositionLookup[c], kb.keyPositionLookup[c]; p != q {
+			moved = append(moved, fmt.Sprintf("%q %v,%v → %v,%v", c, p.i, p.j, q.i, q.j))
+		}
+	}
+	fmt.Fprintf(&str, "\n    Moved: %d keys\n\n", len(moved))
+	g := kb.geometry
+	for i, row := range kb.GridRows() {
+		str.WriteString("    ")
+		for j, token := range strings.Fields(row) {
+			if c := kb.layout[i][j]; g.isFree(i, j) && c != 0 && old.layout[i][j] != c {
+				str.WriteString(token)
+			} else {
+				str.WriteString(grey + token + reset)
+			}
+			str.WriteString("  ")
+		}
+		str.WriteByte('\n')
+	}
+	str.WriteByte('\n')
+	for _, m := range moved {
+		str.WriteString("    " + m + "\n")
+	}
+	str.WriteByte('\n')
+	return str.String()
+}
@@ -0,0 +1,25 @@
+package keyboard
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDiffString(t *testing.T) {
+	old := NewTestKeyboard()
+	old.Corpus, _ = NewCorpus(testBook)
+	old.FillScoreNGrams()
+	kb := old.Copy()
+	kb.ApplySwap('e', 't')
+
+	diff := kb.DiffString(old)
+	if !strings.Contains(diff, "Moved: 2 keys") {
+		t.Errorf("expected two moved keys in\n%v", diff)
+	}
+	if !strings.Contains(diff, "'e'") || !strings.Contains(diff, "'t'") {
+		t.Errorf("expected e and t to be listed as moved in\n%v", diff)
+	}
+	if strings.Count(diff, "\n    ") < len(kb.Stats()) {
+		t.Errorf("expected a line for every stat in\n%v", diff)
+	}
+}
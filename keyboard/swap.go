@@ -0,0 +1,89 @@
+package keyboard
+
+import "sync"
+
+// swapScores are the scratch sums of SwapDelta.
+var swapScores = sync.Pool{New: func() interface{} { return &scores{} }}
+
+// SwapDelta returns how much Score would change if the keys of a and b were
+// exchanged. Only the n-grams containing a or b are rescored, so kb must have
+// been scored with FillScoreNGrams. The keyboard is not modified.
+func (kb *Keyboard) SwapDelta(a, b byte) float64 {
+	if a == b {
+		return 0
+	}
+	s := swapScores.Get().(*scores)
+	defer swapScores.Put(s)
+	s.acc = append(s.acc[:0], kb.acc...)
+	s.length = kb.length
+	s.addSwap(kb.geometry, kb.Corpus, &kb.keyPositionLookup, a, b)
+	return s.score() - kb.scores.score()
+}
+
+// ApplySwap exchanges the keys of a and b and updates the score to match, the
+// same way SwapDelta computes it.
+func (kb *Keyboard) ApplySwap(a, b byte) {
+	if a == b {
+		return
+	}
+	kb.scores.addSwap(kb.geometry, kb.Corpus, &kb.keyPositionLookup, a, b)
+	kb.Swap(a, b)
+}
+
+// addSwap adds how every n-gram of c that contains a or b changes when the
+// keys of a and b, at their positions in lookup, are exchanged.
+func (s *scores) addSwap(g *Geometry, c *Corpus, lookup *[128]KeyPosition, a, b byte) {
+	t := tablesFor(g)
+	swapped := *lookup
+	swapped[a], swapped[b] = lookup[b], lookup[a]
+	s.move(&t.orders[1], g.index(lookup[a]), g.index(swapped[a]), c.counts[a])
+	s.move(&t.orders[1], g.index(lookup[b]), g.index(swapped[b]), c.counts[b])
+
+	for _, i := range c.bigramsByChar[a] {
+		n := c.bigrams[i]
+		s.move(&t.orders[2], g.bigram(lookup[n.a], lookup[n.b]), g.bigram(swapped[n.a], swapped[n.b]), n.count)
+	}
+	for _, i := range c.bigramsByChar[b] {
+		n := c.bigrams[i]
+		if n.a == a || n.b == a {
+			continue
+		}
+		s.move(&t.orders[2], g.bigram(lookup[n.a], lookup[n.b]), g.bigram(swapped[n.a], swapped[n.b]), n.count)
+	}
+
+	for gap := 1; gap <= maxGap; gap++ {
+		for _, i := range c.skipgramsByChar[gap][a] {
+			n := c.skipgrams[gap][i]
+			s.move(&t.skipgrams[gap], g.bigram(lookup[n.a], lookup[n.b]), g.bigram(swapped[n.a], swapped[n.b]), n.count)
+		}
+		for _, i := range c.skipgramsByChar[gap][b] {
+			n := c.skipgrams[gap][i]
+			if n.a == a || n.b == a {
+				continue
+			}
+			s.move(&t.skipgrams[gap], g.bigram(lookup[n.a], lookup[n.b]), g.bigram(swapped[n.a], swapped[n.b]), n.count)
+		}
+	}
+
+	for _, i := range c.trigramsByChar[a] {
+		n := c.trigrams[i]
+		s.move(&t.orders[3], g.trigram(lookup[n.a], lookup[n.b], lookup[n.c]), g.trigram(swapped[n.a], swapped[n.b], swapped[n.c]), n.count)
+	}
+	for _, i := range c.trigramsByChar[b] {
+		n := c.trigrams[i]
+		if n.a == a || n.b == a || n.c == a {
+			continue
+		}
+		s.move(&t.orders[3], g.trigram(lookup[n.a], lookup[n.b], lookup[n.c]), g.trigram(swapped[n.a], swapped[n.b], swapped[n.c]), n.count)
+	}
+}
+
+// move moves count occurrences from the n-gram with index from in t to the
+// one with index to. Nothing changes when both have the same contributions.
+func (s *scores) move(t *table, from, to int, count int64) {
+	if t.class[from] == t.class[to] {
+		return
+	}
+	s.observe(t, from, -count)
+	s.observe(t, to, count)
+}
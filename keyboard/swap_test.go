@@ -0,0 +1,40 @@
+package keyboard
+
+import (
+	"math"
+	prand "math/rand"
+	"strings"
+	"testing"
+)
+
+func TestSwapDelta(t *testing.T) {
+	book := strings.Repeat(testBook, 20)
+	corpus, err := NewCorpus(book)
+	if nil != err {
+		t.Fatal(err)
+	}
+	kb := NewTestKeyboard()
+	kb.Corpus = corpus
+	kb.FillScoreNGrams()
+
+	r := prand.New(prand.NewSource(1))
+	for i := 0; i < 200; i++ {
+		a, b := Chars[r.Intn(len(Chars))], Chars[r.Intn(len(Chars))]
+		before := kb.Score()
+		delta := kb.SwapDelta(a, b)
+		if kb.Score() != before {
+			t.Fatalf("SwapDelta(%q, %q) modified the keyboard", a, b)
+		}
+
+		kb.ApplySwap(a, b)
+		full := kb.Copy()
+		full.FillScoreNGrams()
+
+		if math.Abs(kb.Score()-full.Score()) > 1e-6 {
+			t.Fatalf("ApplySwap(%q, %q) scored %f but a full rescore gives %f", a, b, kb.Score(), full.Score())
+		}
+		if math.Abs(before+delta-full.Score()) > 1e-6 {
+			t.Fatalf("SwapDelta(%q, %q) is %f but the score changed by %f", a, b, delta, full.Score()-before)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package keyboard
+
+// Trigram classes. Trigrams with a same finger bigram, or with the same
+// finger on the first and last key of a one hand trigram, are unclassified.
+const (
+	unclassified = iota
+	// alternate trigrams switch hands on every key.
+	alternate
+	// trigramInroll and trigramOutroll type two keys on one hand, rolling
+	// towards or away from the thumb, and one on the other hand.
+	trigramInroll
+	trigramOutroll
+	// oneHandRoll trigrams type all three keys on one hand in one direction.
+	oneHandRoll
+	// redirect trigrams type all three keys on one hand and change direction.
+	// Bad redirects are redirects without the index finger.
+	redirect
+	badRedirect
+)
+
+// classifyTrigram classifies the trigram typed on z, a and b.
+func (g *Geometry) classifyTrigram(z, a, b KeyPosition) int {
+	if g.absFinger[z.i][z.j] == g.absFinger[a.i][a.j] || g.absFinger[a.i][a.j] == g.absFinger[b.i][b.j] {
+		return unclassified
+	}
+	hz, ha, hb := g.hand[z.i][z.j], g.hand[a.i][a.j], g.hand[b.i][b.j]
+	fz, fa, fb := g.handFinger[z.i][z.j], g.handFinger[a.i][a.j], g.handFinger[b.i][b.j]
+	switch {
+	case hz == hb && ha != hz:
+		return alternate
+	case hz == ha && ha == hb:
+		switch {
+		case fz == fb:
+			return unclassified
+		case (fa > fz) == (fb > fa):
+			return oneHandRoll
+		case fz != 3 && fa != 3 && fb != 3:
+			return badRedirect
+		default:
+			return redirect
+		}
+	case hz == ha:
+		if fa > fz {
+			return trigramInroll
+		}
+		return trigramOutroll
+	default:
+		if fb > fa {
+			return trigramInroll
+		}
+		return trigramOutroll
+	}
+}
+
+func trigramClass(class int) func(g *Geometry, k [3]KeyPosition) float64 {
+	return func(g *Geometry, k [3]KeyPosition) float64 {
+		if g.classifyTrigram(k[0], k[1], k[2]) == class {
+			return 1
+		}
+		return 0
+	}
+}
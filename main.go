@@ -2,20 +2,20 @@ package main
 
 import (
 	"bytes"
-	"crypto/rand"
 	"fmt"
 	"io/ioutil"
 	"log"
-	"math"
-	"math/big"
 	prand "math/rand"
-	"runtime"
+	"os"
 	"sort"
 	"strings"
 
 	"gitlab.com/meutraa/keyboard-gen/keyboard"
 )
 
+// binarySearch returns the first word of a whose cumulative percentage is at
+// least search, or last when there is none in a. The words must be sorted by
+// cumulative percentage, and last is the word following a.
 func binarySearch(a []Word, search float64, last Word) (result *Word, searchCount int) {
 	mid := len(a) / 2
 	switch {
@@ -24,7 +24,7 @@ func binarySearch(a []Word, search float64, last Word) (result *Word, searchCoun
 	case a[mid].cumulativePercentage > search:
 		result, searchCount = binarySearch(a[:mid], search, a[mid])
 	case a[mid].cumulativePercentage < search:
-		result, searchCount = binarySearch(a[mid+1:], search, a[mid])
+		result, searchCount = binarySearch(a[mid+1:], search, last)
 	default:
 		result = &(a[mid])
 	}
@@ -32,18 +32,23 @@ func binarySearch(a []Word, search float64, last Word) (result *Word, searchCoun
 	return
 }
 
-func createMessagesBook() string {
-	bookBytes, err := ioutil.ReadFile("messages.txt")
+func createMessagesBook(path string) (string, error) {
+	bookBytes, err := ioutil.ReadFile(path)
 	if nil != err {
-		log.Fatalln("Unable to open messages.txt file", err)
-		return ""
+		return "", fmt.Errorf("unable to open %v: %w", path, err)
 	}
+	return string(bookBytes), nil
+}
+
+// selectChars sets keyboard.Chars to the n most frequent characters of the
+// corpus, ignoring case and digits.
+func selectChars(corpus *keyboard.Corpus, n int) error {
 	chars := map[byte]int64{}
-	for _, b := range bookBytes {
-		switch b {
+	for _, u := range corpus.Top(1, 128) {
+		switch b := u.Text[0]; b {
 		case '1', '0', '2', '3', '4', '5', '6', '7', '8', '9', 0:
 		default:
-			chars[[]byte(strings.ToLower(string(b)))[0]]++
+			chars[[]byte(strings.ToLower(string(b)))[0]] += u.Count
 		}
 	}
 
@@ -55,61 +60,55 @@ func createMessagesBook() string {
 	var ss []kv
 	for k, v := range chars {
 		ss = append(ss, kv{k, v})
-		log.Printf("|%s| %d", string(k), v)
 	}
 
 	sort.Slice(ss, func(i, j int) bool {
+		if ss[i].Value == ss[j].Value {
+			return ss[i].Key < ss[j].Key
+		}
 		return ss[i].Value > ss[j].Value
 	})
 
-	for i, c := range ss[:keyboard.NChars] {
-		keyboard.Chars[i] = c.Key
-		//log.Printf("|%s| %d", string(c.Key), c.Value)
-	}
-
-	noChars := []string{}
-	for _, c := range ss[keyboard.NChars:] {
-		noChars = append(noChars, string(c.Key))
+	if len(ss) < n {
+		return fmt.Errorf("the corpus has %d distinct characters but the geometry has %d free keys", len(ss), n)
 	}
 
-	words := strings.Fields(string(bookBytes))
-	usedWords := []string{}
-	bannedChars := strings.Join(noChars, "")
-	for _, word := range words {
-		if !strings.ContainsAny(word, bannedChars) {
-			usedWords = append(usedWords, word)
-		}
+	keyboard.Chars = make([]byte, n)
+	for i, c := range ss[:n] {
+		keyboard.Chars[i] = c.Key
 	}
-
-	return string(bookBytes)
+	return nil
 }
 
-func createBook(words []Word, count int, pretty bool) string {
+// Punctuation models of createBook. None leaves out the punctuation of the
+// word list, list keeps it and sentences also ends a sentence every 5 to 14
+// words.
+const (
+	punctuationNone      = "none"
+	punctuationList      = "list"
+	punctuationSentences = "sentences"
+)
+
+// createBook samples count words by their frequency. Every random choice is
+// drawn from r, so the same seed gives the same book.
+func createBook(r *prand.Rand, words []Word, count int, pretty bool, punctuation string) string {
 	lastComma := 20
 	lastWord := ""
 	var book strings.Builder
 	for i := 0; i < count; i++ {
-		ra, err := rand.Int(rand.Reader, big.NewInt(2147483647))
-		if nil != err {
-			log.Println(err)
-			return ""
-		}
-
-		r := float64(ra.Int64()) / 2147483647.0
-		word, _ := binarySearch(words, r, Word{})
+		word, _ := binarySearch(words, r.Float64(), words[len(words)-1])
 		for lastWord == word.word {
-			ra, err := rand.Int(rand.Reader, big.NewInt(2147483647))
-			if nil != err {
-				log.Println(err)
-				return ""
-			}
-
-			r := float64(ra.Int64()) / 2147483647.0
-			word, _ = binarySearch(words, r, Word{})
+			word, _ = binarySearch(words, r.Float64(), words[len(words)-1])
 		}
 
 		//fmt.Printf("%.8f %.8f %.8f %s\n", r, word.cumulativePercentage, word.percentage, word.word)
 
+		switch word.word {
+		case "-", ":", ";", ",", "?", "!", ".":
+			if punctuation == punctuationNone {
+				continue
+			}
+		}
 		switch word.word {
 		case "-":
 			if lastComma == 0 {
@@ -125,7 +124,7 @@ func createBook(words []Word, count int, pretty bool) string {
 			lastComma = 0
 			book.WriteString(word.word)
 		default:
-			if lastComma > prand.Intn(10)+5 {
+			if punctuation == punctuationSentences && lastComma > r.Intn(10)+5 {
 				lastComma = 0
 				book.WriteString(". ")
 				if pretty {
@@ -152,25 +151,47 @@ func createBook(words []Word, count int, pretty bool) string {
 		}
 		lastWord = word.word
 	}
-	b := strings.ReplaceAll(book.String()[2:], " 's", "'s")
+	b := strings.ReplaceAll(strings.TrimLeft(book.String(), " -:;,?!."), " 's", "'s")
 	return b
 }
 
-func searchLoop(thread int, book string, distances *[4][12][4][12]float64, res chan keyboard.Keyboard) {
+func searchLoop(s *search, ws workerState) {
 	mutationsStart := 3
 	mutationsEnd := 0
-	bestScore := initialScore
-
-	sinceLast := 0
-	mutations := mutationsStart
-	total := 0
-	gen := 1
-	kb := keyboard.New()
-	bkb := kb.Copy()
+
+	src := &splitMix{ws.RNG}
+	r := prand.New(src)
+	sc := s.scorer()
+
+	var bkb *keyboard.Keyboard
+	if ws.Layout == "" {
+		bkb = s.newKeyboard(sc, r)
+		ws.Mutations = mutationsStart
+		ws.Gen = 1
+		ws.BestScore = initialScore
+	} else {
+		bkb = s.restore(sc, ws.Layout)
+	}
+	bestScore, sinceLast, mutations, total, gen := ws.BestScore, ws.SinceLast, ws.Mutations, ws.Total, ws.Gen
+
+	report := func() {
+		ws.RNG = src.state
+		ws.Total, ws.Gen, ws.Mutations, ws.SinceLast, ws.BestScore = total, gen, mutations, sinceLast, bestScore
+		ws.Layout = string(bkb.Genome())
+		s.progress <- ws
+	}
+
 	for {
+		if s.done(ws.Thread, total) {
+			report()
+			return
+		}
+		if total%progressInterval == 0 {
+			report()
+		}
 		total++
 		if mutations == mutationsEnd {
-			bkb = keyboard.New()
+			bkb = s.newKeyboard(sc, r)
 			mutations = mutationsStart
 			gen++
 			bestScore = initialScore
@@ -184,24 +205,26 @@ func searchLoop(thread int, book string, distances *[4][12][4][12]float64, res c
 			// log.Println("Switching at try", sinceLast, "mutation iteration to", mutations)
 			sinceLast = 0
 		}
-		kb = bkb.Copy()
-		kb.Book = &book
+		kb := bkb.Copy()
 		for i := 0; i < mutations; i++ {
-			kb.Mutate()
+			a := keyboard.Chars[r.Intn(len(keyboard.Chars))]
+			b := keyboard.Chars[r.Intn(len(keyboard.Chars))]
+			sc.swap(kb, a, b)
 		}
-		kb.FillScore(distances)
+		sc.update(kb)
 		score := kb.Score()
+		s.evaluated()
 		sinceLast++
 		if score < bestScore {
 			kb.Gen = gen
 			kb.Total = total
-			kb.Thread = thread
+			kb.Thread = ws.Thread
 			kb.Mutation = mutations
 			kb.Iteration = sinceLast
 			sinceLast = 0
 			//mutations++
 			bestScore = score
-			res <- *kb
+			s.results <- *kb
 			bkb = kb.Copy()
 		}
 	}
@@ -209,46 +232,48 @@ func searchLoop(thread int, book string, distances *[4][12][4][12]float64, res c
 
 const initialScore = 10000000.0
 
-func main() {
-	runtime.GOMAXPROCS(14)
+type command struct {
+	name        string
+	description string
+	run         func(args []string) error
+}
 
-	/*data, err := Parse()
-	if nil != err {
-		log.Fatalln("unable to parse data", err)
-		return
-	}*/
-
-	//book := createBook(data, 10000, false)
-	book := createMessagesBook()
-
-	results := make(chan keyboard.Keyboard, 16)
-	distances := [4][12][4][12]float64{}
-	for a, va := range distances {
-		for b, vb := range va {
-			for c, vc := range vb {
-				for d, _ := range vc {
-					h := math.Abs(float64(c - a))
-					w := math.Abs(float64(d - b))
-					distances[a][b][c][d] = math.Sqrt(h*h + w*w)
-				}
-			}
-		}
-	}
+var commands = []command{
+	{"optimize", "search for the best layout", optimizeCommand},
+	{"analyze", "score layout files against a corpus", analyzeCommand},
+	{"compare", "rank reference layouts and layout files by score", compareCommand},
+	{"heatmap", "show the frequency, same finger bigrams and effort of every key", heatmapCommand},
+	{"corpus", "show the character and n-gram statistics of a corpus", corpusCommand},
+	{"export", "write a layout from an optimize checkpoint", exportCommand},
+}
 
-	for i := 0; i < 14; i++ {
-		go searchLoop(i, book, &distances, results)
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: %v <command> [flags]\n\ncommands:\n", os.Args[0])
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-10v %v\n", c.name, c.description)
 	}
+	fmt.Fprintf(os.Stderr, "\nRun %v <command> -h for the flags of a command.\n", os.Args[0])
+}
 
-	topScore := initialScore
-
-	for {
-		select {
-		case res := <-results:
-			score := res.Score()
-			if score < topScore {
-				topScore = score
-				fmt.Print((&res).DetailString(), &res, (&res).ScoreString())
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	for _, c := range commands {
+		if c.name == os.Args[1] {
+			if err := c.run(os.Args[2:]); nil != err {
+				log.Fatalln(err)
 			}
+			return
 		}
 	}
+	switch os.Args[1] {
+	case "-h", "-help", "--help", "help":
+		usage()
+		return
+	}
+	fmt.Fprintf(os.Stderr, "unknown command %v\n\n", os.Args[1])
+	usage()
+	os.Exit(2)
 }
@@ -1,40 +1,456 @@
 package main
 
 import (
-	"log"
+	"context"
+	"io/ioutil"
 	"math"
+	prand "math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
 
 	"gitlab.com/meutraa/keyboard-gen/keyboard"
 )
 
+// benchmarkKeyboard scores a random layout against messages.txt.
+func benchmarkKeyboard(b *testing.B) *keyboard.Keyboard {
+	book, err := createMessagesBook("messages.txt")
+	if nil != err {
+		b.Fatal(err)
+	}
+	corpus, err := keyboard.NewCorpus(book)
+	if nil != err {
+		b.Fatal(err)
+	}
+	g := keyboard.DefaultGeometry()
+	if err := selectChars(corpus, g.FreeKeys()); nil != err {
+		b.Fatal(err)
+	}
+	kb := keyboard.New(g, prand.New(prand.NewSource(0)))
+	kb.Book = &book
+	kb.Corpus = corpus
+	return kb
+}
+
 func BenchmarkFillScore(b *testing.B) {
-	kb := keyboard.New()
-	kb.Fill(0)
-	data, err := Parse()
+	kb := benchmarkKeyboard(b)
+	state := &keyboard.ScoreState{}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		kb.FillScore(state)
+	}
+}
+
+func BenchmarkFillScoreNGrams(b *testing.B) {
+	kb := benchmarkKeyboard(b)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		kb.FillScoreNGrams()
+	}
+}
+
+func BenchmarkSwapDelta(b *testing.B) {
+	kb := benchmarkKeyboard(b)
+	kb.FillScoreNGrams()
+	r := prand.New(prand.NewSource(0))
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		kb.SwapDelta(keyboard.Chars[r.Intn(len(keyboard.Chars))], keyboard.Chars[r.Intn(len(keyboard.Chars))])
+	}
+}
+
+func BenchmarkApplySwap(b *testing.B) {
+	kb := benchmarkKeyboard(b)
+	kb.FillScoreNGrams()
+	r := prand.New(prand.NewSource(0))
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		kb.ApplySwap(keyboard.Chars[r.Intn(len(keyboard.Chars))], keyboard.Chars[r.Intn(len(keyboard.Chars))])
+	}
+}
+
+func TestCleanMessage(t *testing.T) {
+	for _, c := range []struct{ body, want string }{
+		{"> <@mariam:lost.host> Why?\n> Really?\n\nI just forget.", "I just forget."},
+		{"> test", "> test"},
+		{"See https://example.com/a?b=c#d now", "See  now"},
+		{"Code:\n```\nint main() {}\n```\ndone", "Code:\n\ndone"},
+		{"unclosed ```\ncode", "unclosed"},
+		{"caf\u00e9 \U0001f600", ""},
+		{"a na\u00efve idea", "a idea"},
+		{"na\u00efve idea\ncaf\u00e9 au lait", "idea\nau lait"},
+	} {
+		if got := cleanMessage(c.body); got != c.want {
+			t.Errorf("cleanMessage(%q) is %q, want %q", c.body, got, c.want)
+		}
+	}
+}
+
+func TestCreateMatrixBook(t *testing.T) {
+	dir, err := ioutil.TempDir("", "matrix")
 	if nil != err {
-		log.Fatalln("unable to parse data", err)
-		return
+		t.Fatal(err)
 	}
+	defer os.RemoveAll(dir)
 
-	book := createBook(data, 10000, false)
-	kb.Book = &book
+	events := filepath.Join(dir, "events.json")
+	ioutil.WriteFile(events, []byte(`{"messages": [
+		{"sender": "@a:x", "content": {"msgtype": "m.text", "body": "one"}},
+		{"sender": "@b:x", "content": {"msgtype": "m.text", "body": "two"}},
+		{"sender": "@a:x", "content": {"msgtype": "m.notice", "body": "three"}},
+		{"sender": "@a:x", "content": {"msgtype": "m.text", "body": "https://example.com"}}
+	]}`), 0644)
+	contents := filepath.Join(dir, "contents.json")
+	ioutil.WriteFile(contents, []byte(`[
+		{"msgtype": "m.text", "body": "one"},
+		{"msgtype": "m.emote", "body": "waves"}
+	]`), 0644)
+
+	for _, c := range []struct {
+		path string
+		f    matrixFilter
+		want string
+	}{
+		{events, matrixFilter{msgTypes: []string{"m.text"}}, "one\ntwo\n"},
+		{events, matrixFilter{msgTypes: []string{"m.text", "m.notice"}, senders: []string{"@a:x"}}, "one\nthree\n"},
+		{contents, matrixFilter{msgTypes: []string{"m.text", "m.emote"}}, "one\nwaves\n"},
+	} {
+		book, err := createMatrixBook(c.path, c.f)
+		if nil != err {
+			t.Fatal(err)
+		}
+		if book != c.want {
+			t.Errorf("%v with %+v: expected %q but got %q", filepath.Base(c.path), c.f, c.want, book)
+		}
+	}
+	if _, err := createMatrixBook(events, matrixFilter{msgTypes: []string{"m.file"}}); nil == err {
+		t.Errorf("expected an error when no message matches")
+	}
+}
+
+func TestCleanCode(t *testing.T) {
+	src := "package main\r\n\n\n/* block\ncomment */\nfunc f() {\n\tx  := \"a \\\"b\\\"\" // note\n\ty := `raw\nstring` + 'c'\n}\n"
+	for _, c := range []struct {
+		f    codeFilter
+		want string
+	}{
+		{codeFilter{indent: "keep"}, "package main\n\n/* block\ncomment */\nfunc f() {\n\tx  := \"a \\\"b\\\"\" // note\n\ty := `raw\nstring` + 'c'\n}\n"},
+		{codeFilter{indent: "none", stripComments: true}, "package main\n\nfunc f() {\nx := \"a \\\"b\\\"\"\ny := `raw\nstring` + 'c'\n}\n"},
+		{codeFilter{indent: "tab", stripComments: true, stripStrings: true}, "package main\n\nfunc f() {\n\tx := \"\"\n\ty := `` + ''\n}\n"},
+	} {
+		if got := cleanCode(src, syntaxes[".go"], c.f); got != c.want {
+			t.Errorf("%+v: expected %q but got %q", c.f, c.want, got)
+		}
+	}
+}
+
+func TestCreateWordsBook(t *testing.T) {
+	dir, err := ioutil.TempDir("", "words")
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	list := filepath.Join(dir, "words.txt")
+	ioutil.WriteFile(list, []byte("the 9000\nof 8000\n, 7000\n. 6000\ncafé 6000\nrare 10\nx2 9000\n"), 0644)
+
+	for _, c := range []struct {
+		cfg     wordsConfig
+		allowed string
+	}{
+		{wordsConfig{filter: wordFilter{minCount: 5000}, length: 200, punctuation: punctuationNone}, "theof "},
+		{wordsConfig{filter: wordFilter{minCount: 5000}, length: 200, punctuation: punctuationSentences}, "theof ,."},
+		{wordsConfig{filter: wordFilter{minCount: 1, alphabet: "ethar"}, length: 200, punctuation: punctuationList}, "thear "},
+	} {
+		book, err := createWordsBook(list, c.cfg)
+		if nil != err {
+			t.Fatal(err)
+		}
+		if i := strings.IndexFunc(book, func(r rune) bool { return !strings.ContainsRune(c.allowed, r) }); i >= 0 {
+			t.Errorf("%+v: expected only %q but the book has %q", c.cfg, c.allowed, book[i])
+		}
+	}
+
+	cfg := wordsConfig{filter: wordFilter{minCount: 5000}, length: 50, punctuation: punctuationList, cache: filepath.Join(dir, "cache")}
+	book, err := createWordsBook(list, cfg)
+	if nil != err {
+		t.Fatal(err)
+	}
+	cached, _ := filepath.Glob(filepath.Join(cfg.cache, "*.txt"))
+	if len(cached) != 1 {
+		t.Fatalf("expected one cached book but found %v", cached)
+	}
+	ioutil.WriteFile(cached[0], []byte("from the cache"), 0644)
+	if again, _ := createWordsBook(list, cfg); again != "from the cache" {
+		t.Errorf("expected the book to be read from the cache")
+	}
+	cfg.length++
+	if other, _ := createWordsBook(list, cfg); other == "from the cache" || other == book {
+		t.Errorf("expected a different length to generate a new book")
+	}
+}
+
+func TestBinarySearch(t *testing.T) {
+	words := []Word{
+		{word: "the", cumulativePercentage: 0.4},
+		{word: "of", cumulativePercentage: 0.6},
+		{word: "and", cumulativePercentage: 0.75},
+		{word: ",", cumulativePercentage: 0.85},
+		{word: "keyboard", cumulativePercentage: 1},
+	}
+	for _, c := range []struct {
+		search float64
+		want   string
+	}{{0, "the"}, {0.4, "the"}, {0.5, "of"}, {0.7, "and"}, {0.8, ","}, {0.9, "keyboard"}, {1, "keyboard"}} {
+		if got, _ := binarySearch(words, c.search, words[len(words)-1]); got.word != c.want {
+			t.Errorf("binarySearch(%v) is %q, want %q", c.search, got.word, c.want)
+		}
+	}
+}
+
+func TestCreateBookSeeded(t *testing.T) {
+	words := []Word{
+		{word: "the", cumulativePercentage: 0.4},
+		{word: "of", cumulativePercentage: 0.6},
+		{word: "and", cumulativePercentage: 0.75},
+		{word: ",", cumulativePercentage: 0.85},
+		{word: "keyboard", cumulativePercentage: 1},
+	}
+	book := func(seed int64) string {
+		return createBook(prand.New(prand.NewSource(seed)), words, 1000, true, punctuationSentences)
+	}
+	if a, b := book(7), book(7); a != b {
+		t.Errorf("expected the same seed to generate the same book")
+	}
+	if book(7) == book(8) {
+		t.Errorf("expected different seeds to generate different books")
+	}
+}
+
+func TestCreateWordsBookSeeded(t *testing.T) {
+	dir, err := ioutil.TempDir("", "words")
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// Words as frequent as each other must still be ordered the same way
+	// every time the list is read.
+	list := filepath.Join(dir, "words.txt")
+	ioutil.WriteFile(list, []byte("the 9000\nof 6000\nand 6000\nto 6000\nin 6000\nit 6000\nis 6000\nbe 6000\n"), 0644)
+
+	cfg := wordsConfig{filter: wordFilter{minCount: 5000}, length: 500, punctuation: punctuationNone, seed: 3}
+	want, err := createWordsBook(list, cfg)
+	if nil != err {
+		t.Fatal(err)
+	}
+	for i := 0; i < 20; i++ {
+		if book, _ := createWordsBook(list, cfg); book != want {
+			t.Fatalf("expected the same seed to generate the same book")
+		}
+	}
+}
+
+func TestCheckpointConflicts(t *testing.T) {
+	defer func() { keyboard.ScoreProfile = keyboard.DefaultProfile() }()
+	cp := &checkpoint{Seed: 3, Strategy: "anneal", Profile: keyboard.DefaultProfile(), Workers: make([]workerState, 2)}
+	keyboard.ScoreProfile = keyboard.DefaultProfile()
 
-	distances := [4][12][4][12]float64{}
-	for a, va := range distances {
-		for b, vb := range va {
-			for c, vc := range vb {
-				for d, _ := range vc {
-					h := math.Abs(float64(c - a))
-					w := math.Abs(float64(d - b))
-					distances[a][b][c][d] = math.Sqrt(h*h + w*w)
-				}
+	none := map[string]bool{}
+	if err := cp.conflicts(none, 1, "climb", objectiveExact, 8); nil != err {
+		t.Errorf("expected defaults to be ignored but got %v", err)
+	}
+	all := map[string]bool{"seed": true, "strategy": true, "objective": true, "workers": true, "profile": true}
+	if err := cp.conflicts(all, 3, "anneal", objectiveNGrams, 2); nil != err {
+		t.Errorf("expected flags matching the checkpoint to be accepted but got %v", err)
+	}
+	for _, c := range []struct {
+		flag      string
+		seed      int64
+		strategy  string
+		objective string
+		workers   int
+	}{
+		{"seed", 4, "anneal", objectiveNGrams, 2},
+		{"strategy", 3, "climb", objectiveNGrams, 2},
+		{"objective", 3, "anneal", objectiveExact, 2},
+		{"workers", 3, "anneal", objectiveNGrams, 4},
+	} {
+		if err := cp.conflicts(map[string]bool{c.flag: true}, c.seed, c.strategy, c.objective, c.workers); nil == err {
+			t.Errorf("expected an error for a conflicting -%v", c.flag)
+		}
+	}
+	keyboard.ScoreProfile, _ = keyboard.BundledProfile("low-sfb")
+	if err := cp.conflicts(map[string]bool{"profile": true}, 3, "anneal", objectiveNGrams, 2); nil == err {
+		t.Errorf("expected an error for a conflicting -profile")
+	}
+}
+
+// testSearch returns a search over the start of messages.txt, scored with the
+// ngrams objective, whose workers stop after maxEvaluations in total.
+func testSearch(t *testing.T, workers, maxEvaluations int) *search {
+	book, err := createMessagesBook("messages.txt")
+	if nil != err {
+		t.Fatal(err)
+	}
+	corpus, err := keyboard.NewCorpus(book[:20000])
+	if nil != err {
+		t.Fatal(err)
+	}
+	g := keyboard.DefaultGeometry()
+	if err := selectChars(corpus, g.FreeKeys()); nil != err {
+		t.Fatal(err)
+	}
+	return &search{
+		ctx:            context.Background(),
+		corpus:         corpus,
+		geometry:       g,
+		scorer:         func() *scorer { return &scorer{} },
+		results:        make(chan keyboard.Keyboard, 16),
+		progress:       make(chan workerState, workers),
+		maxEvaluations: maxEvaluations,
+		workers:        workers,
+	}
+}
+
+// runSearch runs loop for every worker until they all stop, the way optimize
+// does, and returns the genome of the best layout found and the last state
+// of each worker.
+func runSearch(s *search, workers []workerState, loop func(*search, workerState)) (string, []workerState) {
+	var wg sync.WaitGroup
+	for _, ws := range workers {
+		wg.Add(1)
+		go func(ws workerState) {
+			defer wg.Done()
+			loop(s, ws)
+		}(ws)
+	}
+	finished := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(finished)
+	}()
+
+	states := append([]workerState{}, workers...)
+	best, bestScore := "", initialScore
+	improve := func(res keyboard.Keyboard) {
+		// Ties go to the smaller genome so that the order in which workers
+		// report does not matter.
+		genome := string(res.Genome())
+		if score := res.Score(); score < bestScore || score == bestScore && genome < best {
+			best, bestScore = genome, score
+		}
+	}
+	for {
+		select {
+		case res := <-s.results:
+			improve(res)
+		case ws := <-s.progress:
+			states[ws.Thread] = ws
+		case <-finished:
+			for len(s.results) > 0 {
+				improve(<-s.results)
+			}
+			for len(s.progress) > 0 {
+				ws := <-s.progress
+				states[ws.Thread] = ws
 			}
+			return best, states
 		}
 	}
+}
 
-	b.ResetTimer()
-	for i := 0; i < b.N; i++ {
-		kb.FillScore(&distances)
+// testAnneal is a short annealing schedule for tests.
+var testAnneal = annealConfig{
+	schedule:       scheduleGeometric,
+	temperature:    5000,
+	minTemperature: 1,
+	cooling:        0.999,
+	acceptance:     0.05,
+	window:         1000,
+	reheat:         50000,
+}
+
+func TestAnnealResume(t *testing.T) {
+	loop := func(s *search, ws workerState) { annealLoop(s, ws, testAnneal) }
+	_, whole := runSearch(testSearch(t, 2, 6000), newWorkers(1, 2), loop)
+	_, half := runSearch(testSearch(t, 2, 3000), newWorkers(1, 2), loop)
+	_, resumed := runSearch(testSearch(t, 2, 6000), half, loop)
+
+	for i, ws := range resumed {
+		if ws.Total != 3000 {
+			t.Errorf("expected worker %d to stop after 3000 evaluations but got %d", i, ws.Total)
+		}
+		// The resumed worker rescores its layout from scratch rather than
+		// from swaps, so the scores only agree to rounding.
+		if ws.Best == "" || ws.Best != whole[i].Best || math.Abs(ws.BestScore-whole[i].BestScore) > 1e-6 {
+			t.Errorf("expected worker %d to resume to best %q (%v) but got %q (%v)", i, whole[i].Best, whole[i].BestScore, ws.Best, ws.BestScore)
+		}
+		if ws.Layout != whole[i].Layout {
+			t.Errorf("expected worker %d to resume to layout %q but got %q", i, whole[i].Layout, ws.Layout)
+		}
+	}
+}
+
+// testSeeded runs loop twice on the same seed with a small budget and checks
+// that both runs stop and find the same best layout.
+func testSeeded(t *testing.T, loop func(*search, workerState)) {
+	const workers, budget = 2, 4000
+	bests := make([]string, 2)
+	for i := range bests {
+		s := testSearch(t, workers, budget)
+		best, states := runSearch(s, newWorkers(1, workers), loop)
+		if best == "" {
+			t.Fatalf("expected a best layout")
+		}
+		total := 0
+		for _, ws := range states {
+			total += ws.Total
+		}
+		if total < budget || int64(total) != s.evaluations {
+			t.Errorf("expected the workers to stop after %d evaluations but they reported %d of %d", budget, total, s.evaluations)
+		}
+		bests[i] = best
+	}
+	if bests[0] != bests[1] {
+		t.Errorf("expected the same seed to find the same best but got %q and %q", bests[0], bests[1])
+	}
+}
+
+func TestAnnealLoopSeeded(t *testing.T) {
+	testSeeded(t, func(s *search, ws workerState) { annealLoop(s, ws, testAnneal) })
+}
+
+func TestGeneticLoopSeeded(t *testing.T) {
+	cfg := geneticConfig{population: 20, elite: 2, tournament: 3, mutation: 0.3, crossover: "all"}
+	testSeeded(t, func(s *search, ws workerState) { geneticLoop(s, ws, cfg) })
+}
+
+func TestSearchLoopSeeded(t *testing.T) {
+	testSeeded(t, searchLoop)
+}
+
+func TestMaxEvaluations(t *testing.T) {
+	for name, loop := range map[string]func(*search, workerState){
+		"climb":  searchLoop,
+		"anneal": func(s *search, ws workerState) { annealLoop(s, ws, testAnneal) },
+	} {
+		// The odd evaluation goes to the first worker.
+		_, states := runSearch(testSearch(t, 2, 1001), newWorkers(1, 2), loop)
+		if states[0].Total != 501 || states[1].Total != 500 {
+			t.Errorf("expected %v workers to stop after 501 and 500 evaluations but got %d and %d", name, states[0].Total, states[1].Total)
+		}
+
+		s := testSearch(t, 2, 0)
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		s.ctx = ctx
+		if _, states := runSearch(s, newWorkers(1, 2), loop); states[0].Total != 0 || states[1].Total != 0 {
+			t.Errorf("expected cancelled %v workers to stop at once but got %d and %d evaluations", name, states[0].Total, states[1].Total)
+		}
 	}
 }
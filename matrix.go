@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strings"
+)
+
+// matrixEvent is a message of a Matrix room export. Exports either hold whole
+// events, with the message in content, or only the content of each event.
+type matrixEvent struct {
+	Sender  string         `json:"sender"`
+	Content *matrixContent `json:"content"`
+	matrixContent
+}
+
+type matrixContent struct {
+	MsgType string `json:"msgtype"`
+	Body    string `json:"body"`
+}
+
+// matrixFilter picks the messages of an export that go into a book. An empty
+// senders list takes the messages of everyone.
+type matrixFilter struct {
+	msgTypes []string
+	senders  []string
+}
+
+func (f matrixFilter) match(e matrixEvent) bool {
+	content := e.matrixContent
+	if nil != e.Content {
+		content = *e.Content
+	}
+	if !contains(f.msgTypes, content.MsgType) {
+		return false
+	}
+	return len(f.senders) == 0 || contains(f.senders, e.Sender)
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	codeBlockPattern = regexp.MustCompile("(?s)```.*?(```|$)")
+	urlPattern       = regexp.MustCompile(`(?i)\b(https?|ftp)://\S+|\bwww\.\S+`)
+	// nonASCIIPattern matches a word with a character outside ASCII and the
+	// spaces that separate it from the previous word, or from the next one
+	// when it starts a line.
+	nonASCIIPattern = regexp.MustCompile(`(?m)^\S*[^\x00-\x7f]\S*[ \t]*|[ \t]*\S*[^\x00-\x7f]\S*`)
+)
+
+// cleanMessage strips from a message body what was not typed as prose: the
+// quote of the replied to message that clients put before a reply, fenced
+// code blocks and URLs. Words with characters outside ASCII are dropped too,
+// since a corpus must be ASCII, and dropping only those characters would join
+// their neighbours into bigrams that were never typed.
+func cleanMessage(body string) string {
+	if strings.HasPrefix(body, "> <") {
+		lines := strings.Split(body, "\n")
+		for len(lines) > 0 && strings.HasPrefix(lines[0], ">") {
+			lines = lines[1:]
+		}
+		body = strings.Join(lines, "\n")
+	}
+	body = codeBlockPattern.ReplaceAllString(body, "")
+	body = urlPattern.ReplaceAllString(body, "")
+	body = nonASCIIPattern.ReplaceAllString(body, "")
+	return strings.TrimSpace(body)
+}
+
+// createMatrixBook reads a Matrix room export, a JSON array of events or of
+// their content, or an object holding that array in messages or chunk. The
+// book is the cleaned body of every message that f matches, one per line.
+func createMatrixBook(path string, f matrixFilter) (string, error) {
+	data, err := ioutil.ReadFile(path)
+	if nil != err {
+		return "", fmt.Errorf("unable to open %v: %w", path, err)
+	}
+	events := []matrixEvent{}
+	if err := json.Unmarshal(data, &events); nil != err {
+		export := struct {
+			Messages []matrixEvent `json:"messages"`
+			Chunk    []matrixEvent `json:"chunk"`
+		}{}
+		if err := json.Unmarshal(data, &export); nil != err {
+			return "", fmt.Errorf("unable to parse %v: %w", path, err)
+		}
+		events = append(export.Messages, export.Chunk...)
+	}
+
+	var book strings.Builder
+	for _, e := range events {
+		if !f.match(e) {
+			continue
+		}
+		body := e.Body
+		if nil != e.Content {
+			body = e.Content.Body
+		}
+		if body = cleanMessage(body); body != "" {
+			book.WriteString(body)
+			book.WriteByte('\n')
+		}
+	}
+	if book.Len() == 0 {
+		return "", fmt.Errorf("%v has no messages to build a book from", path)
+	}
+	return book.String(), nil
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"gitlab.com/meutraa/keyboard-gen/keyboard"
+)
+
+// The objective is how layouts are scored. The ngrams objective, the default,
+// scores from the n-gram tables of the corpus with FillScoreNGrams and rescores
+// a swap from only the n-grams it touches, but it estimates distance and hand
+// overuse from trigrams. The exact objective walks the book key press by key
+// press with FillScore, which is several times slower and needs a single
+// corpus.
+const (
+	objectiveExact  = "exact"
+	objectiveNGrams = "ngrams"
+)
+
+// scorer scores layouts by an objective. It keeps the state of FillScore, so
+// each goroutine needs its own. A nil book scores with the ngrams objective.
+type scorer struct {
+	book  *string
+	state keyboard.ScoreState
+	// trial is the layout swapDelta scored for applySwap.
+	trial *keyboard.Keyboard
+}
+
+// score scores kb from scratch.
+func (sc *scorer) score(kb *keyboard.Keyboard) {
+	if nil == sc.book {
+		kb.FillScoreNGrams()
+		return
+	}
+	kb.Book = sc.book
+	kb.FillScore(&sc.state)
+}
+
+// swap exchanges the keys of a and b. With the exact objective the score is
+// out of date until update.
+func (sc *scorer) swap(kb *keyboard.Keyboard, a, b byte) {
+	if nil == sc.book {
+		kb.ApplySwap(a, b)
+		return
+	}
+	kb.Swap(a, b)
+}
+
+// update rescores kb after swap.
+func (sc *scorer) update(kb *keyboard.Keyboard) {
+	if nil != sc.book {
+		sc.score(kb)
+	}
+}
+
+// swapDelta returns how much the score of kb would change if the keys of a
+// and b were exchanged, without modifying kb.
+func (sc *scorer) swapDelta(kb *keyboard.Keyboard, a, b byte) float64 {
+	if nil == sc.book {
+		return kb.SwapDelta(a, b)
+	}
+	sc.trial = kb.Copy()
+	sc.trial.Swap(a, b)
+	sc.score(sc.trial)
+	return sc.trial.Score() - kb.Score()
+}
+
+// applySwap returns kb with the keys of a and b exchanged and rescored. It
+// must follow swapDelta of the same keys.
+func (sc *scorer) applySwap(kb *keyboard.Keyboard, a, b byte) *keyboard.Keyboard {
+	if nil == sc.book {
+		kb.ApplySwap(a, b)
+		return kb
+	}
+	return sc.trial
+}
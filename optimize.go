@@ -0,0 +1,285 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"gitlab.com/meutraa/keyboard-gen/keyboard"
+)
+
+// layoutJSON is how the optimize and export commands write a layout with
+// -format json.
+type layoutJSON struct {
+	Geometry string   `json:"geometry"`
+	Thread   int      `json:"thread"`
+	Gen      int      `json:"gen"`
+	Total    int      `json:"total"`
+	Score    float64  `json:"score"`
+	Layout   string   `json:"layout"`
+	Rows     []string `json:"rows"`
+}
+
+func newLayoutJSON(kb *keyboard.Keyboard, score float64) layoutJSON {
+	return layoutJSON{
+		Geometry: kb.Geometry().Name,
+		Thread:   kb.Thread,
+		Gen:      kb.Gen,
+		Total:    kb.Total,
+		Score:    score,
+		Layout:   string(kb.Genome()),
+		Rows:     kb.GridRows(),
+	}
+}
+
+func printLayout(format string, kb *keyboard.Keyboard) {
+	if format == "json" {
+		data, err := json.Marshal(newLayoutJSON(kb, kb.Score()))
+		if nil != err {
+			log.Println("unable to encode layout", err)
+			return
+		}
+		fmt.Println(string(data))
+		return
+	}
+	fmt.Print(kb.DetailString(), kb, kb.ScoreString())
+}
+
+func optimizeCommand(args []string) error {
+	fs := flag.NewFlagSet("optimize", flag.ExitOnError)
+	opts := options{}
+	opts.register(fs)
+	opts.registerProfile(fs)
+	seed := fs.Int64("seed", time.Now().UnixNano(), "seed of the random layouts and mutations")
+	workers := fs.Int("workers", runtime.NumCPU(), "number of search workers")
+	strategy := fs.String("strategy", "climb", "search strategy, climb, anneal or genetic")
+	anneal := annealConfig{}
+	fs.StringVar(&anneal.schedule, "schedule", scheduleGeometric, "annealing schedule, geometric, adaptive or reheat")
+	fs.Float64Var(&anneal.temperature, "temperature", 5000, "initial annealing temperature")
+	fs.Float64Var(&anneal.minTemperature, "min-temperature", 1, "lowest annealing temperature")
+	fs.Float64Var(&anneal.cooling, "cooling", 0.99995, "temperature multiplier per annealing step")
+	fs.Float64Var(&anneal.acceptance, "acceptance", 0.05, "target ratio of accepted swaps for the adaptive schedule")
+	fs.IntVar(&anneal.window, "window", 1000, "steps between temperature changes of the adaptive schedule")
+	fs.IntVar(&anneal.reheat, "reheat", 50000, "steps without a new best before the reheat schedule reheats")
+	genetic := geneticConfig{}
+	fs.IntVar(&genetic.population, "population", 100, "layouts per genetic population")
+	fs.IntVar(&genetic.elite, "elite", 2, "best layouts kept unchanged between generations")
+	fs.IntVar(&genetic.tournament, "tournament", 3, "layouts competing to become a parent")
+	fs.Float64Var(&genetic.mutation, "mutation", 0.3, "probability of each further mutation of a child")
+	fs.StringVar(&genetic.crossover, "crossover", "all", "crossover operator, pmx, cx, ox or all")
+	checkpointPath := fs.String("checkpoint", "", "file to periodically save the search to")
+	checkpointInterval := fs.Duration("checkpoint-interval", time.Minute, "time between checkpoints")
+	resume := fs.String("resume", "", "checkpoint to resume the search from, also used as -checkpoint unless that is set")
+	timeLimit := fs.Duration("time", 0, "stop after this long")
+	maxEvaluations := fs.Int("max-evaluations", 0, "stop after scoring this many layouts in total, counting resumed ones")
+	target := fs.Float64("target", 0, "stop once a layout scores this or lower")
+	stall := fs.Int64("stall", 0, "stop after this many evaluations without a new best layout")
+	fs.Parse(args)
+
+	if err := opts.validate(); nil != err {
+		return err
+	}
+	if err := opts.loadProfile(); nil != err {
+		return err
+	}
+
+	var cp *checkpoint
+	if *resume != "" {
+		var err error
+		cp, err = loadCheckpoint(*resume)
+		if nil != err {
+			return fmt.Errorf("unable to load checkpoint: %w", err)
+		}
+		set := map[string]bool{}
+		fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+		if err := cp.conflicts(set, *seed, *strategy, opts.objective, *workers); nil != err {
+			return fmt.Errorf("unable to resume from checkpoint: %w", err)
+		}
+		*seed = cp.Seed
+		*strategy = cp.Strategy
+		opts.objective = cp.objective()
+		*workers = len(cp.Workers)
+		if nil != cp.Profile {
+			keyboard.ScoreProfile = cp.Profile
+		}
+		if *checkpointPath == "" {
+			*checkpointPath = *resume
+		}
+	}
+
+	switch *strategy {
+	case "climb":
+	case "anneal":
+		if err := anneal.validate(); nil != err {
+			return fmt.Errorf("invalid annealing options: %w", err)
+		}
+	case "genetic":
+		if err := genetic.validate(); nil != err {
+			return fmt.Errorf("invalid genetic options: %w", err)
+		}
+	default:
+		return fmt.Errorf("unknown strategy %v", *strategy)
+	}
+	if *workers < 1 {
+		return fmt.Errorf("workers must be at least 1")
+	}
+
+	runtime.GOMAXPROCS(*workers)
+
+	g, err := opts.loadGeometry()
+	if nil != err {
+		return err
+	}
+	corpus, err := opts.loadCorpus(g)
+	if nil != err {
+		return err
+	}
+
+	if nil == cp {
+		cp = &checkpoint{
+			Seed:      *seed,
+			Strategy:  *strategy,
+			Objective: opts.objective,
+			Chars:     string(keyboard.Chars),
+			Profile:   keyboard.ScoreProfile,
+			BestScore: initialScore,
+		}
+		cp.Workers = newWorkers(*seed, *workers)
+	} else if err := cp.validate(g, genetic); nil != err {
+		return fmt.Errorf("unable to resume from checkpoint: %w", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s := &search{
+		ctx:            ctx,
+		corpus:         corpus,
+		geometry:       g,
+		scorer:         opts.scorer,
+		results:        make(chan keyboard.Keyboard, 16),
+		progress:       make(chan workerState, len(cp.Workers)),
+		maxEvaluations: *maxEvaluations,
+		workers:        len(cp.Workers),
+	}
+
+	var best *keyboard.Keyboard
+	if cp.Best != "" {
+		best = s.restore(s.scorer(), cp.Best)
+	}
+
+	log.Println("seed", *seed)
+	var wg sync.WaitGroup
+	for _, ws := range cp.Workers {
+		wg.Add(1)
+		go func(ws workerState) {
+			defer wg.Done()
+			switch *strategy {
+			case "climb":
+				searchLoop(s, ws)
+			case "anneal":
+				annealLoop(s, ws, anneal)
+			case "genetic":
+				geneticLoop(s, ws, genetic)
+			}
+		}(ws)
+	}
+	finished := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(finished)
+	}()
+
+	var tick <-chan time.Time
+	if *checkpointPath != "" {
+		tick = time.NewTicker(*checkpointInterval).C
+	}
+	save := func() {
+		if *checkpointPath == "" {
+			return
+		}
+		if err := cp.save(*checkpointPath); nil != err {
+			log.Println("unable to save checkpoint", err)
+		}
+	}
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	var deadline <-chan time.Time
+	if *timeLimit > 0 {
+		deadline = time.After(*timeLimit)
+	}
+	poll := time.NewTicker(100 * time.Millisecond)
+	defer poll.Stop()
+	lastImprovement := int64(0)
+	stop := func(reason ...interface{}) {
+		if ctx.Err() == nil {
+			log.Println(append([]interface{}{"stopping:"}, reason...)...)
+			cancel()
+		}
+	}
+
+	improve := func(res keyboard.Keyboard) {
+		score := res.Score()
+		if score < cp.BestScore {
+			cp.BestScore = score
+			cp.Best = string(res.Genome())
+			lastImprovement = atomic.LoadInt64(&s.evaluations)
+			if opts.format == "text" && nil != best {
+				// Show what changed since the previous best.
+				fmt.Print(res.DetailString(), res.DiffString(best))
+			} else {
+				printLayout(opts.format, &res)
+			}
+			best = &res
+		}
+		if *target > 0 && cp.BestScore <= *target {
+			stop("reached target score", *target)
+		}
+	}
+
+	// Workers stop on their own once they have used their share of
+	// -max-evaluations, otherwise they run until stop cancels them. Either way
+	// results and progress are read until every worker has returned, and then
+	// whatever they sent last is drained from the buffers.
+	for {
+		select {
+		case res := <-s.results:
+			improve(res)
+		case ws := <-s.progress:
+			cp.Workers[ws.Thread] = ws
+		case <-tick:
+			save()
+		case <-poll.C:
+			if *stall > 0 && atomic.LoadInt64(&s.evaluations)-lastImprovement >= *stall {
+				stop("no improvement in", *stall, "evaluations")
+			}
+		case <-deadline:
+			stop("reached time limit", *timeLimit)
+		case sig := <-signals:
+			stop("received", sig)
+		case <-finished:
+			for len(s.results) > 0 {
+				improve(<-s.results)
+			}
+			for len(s.progress) > 0 {
+				ws := <-s.progress
+				cp.Workers[ws.Thread] = ws
+			}
+			save()
+			log.Println("evaluations", atomic.LoadInt64(&s.evaluations))
+			if nil != best {
+				printLayout(opts.format, best)
+			}
+			return nil
+		}
+	}
+}
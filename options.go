@@ -0,0 +1,204 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gitlab.com/meutraa/keyboard-gen/keyboard"
+)
+
+// options are the flags shared by the commands that need a geometry, a
+// corpus or formatted output.
+type options struct {
+	geometry   string
+	corpus     string
+	words      wordsConfig
+	format     string
+	profile    string
+	msgTypes   string
+	senders    string
+	code       codeFilter
+	extensions string
+	objective  string
+	// book is the text of the corpus when it has a single source.
+	book string
+}
+
+func (o *options) register(fs *flag.FlagSet) {
+	fs.StringVar(&o.geometry, "geometry", "", "path to a JSON keyboard geometry, defaults to the 4x12 ortholinear board")
+	fs.StringVar(&o.corpus, "corpus", "messages.txt", "corpus to score layouts against, as comma separated sources [kind:]path[=weight] where kind is text, words, matrix or code")
+	fs.IntVar(&o.words.length, "book-length", 10000, "words to generate from a words corpus")
+	fs.Int64Var(&o.words.filter.minCount, "min-count", 5000, "least count of the words to read from a words corpus")
+	fs.StringVar(&o.words.filter.alphabet, "alphabet", "", "characters the words read from a words corpus may use, defaults to all but digits and symbols")
+	fs.StringVar(&o.words.punctuation, "punctuation", punctuationSentences, "punctuation of a words corpus, none, list to keep the punctuation of the word list or sentences to also end sentences")
+	fs.Int64Var(&o.words.seed, "book-seed", 0, "seed of the book generated from a words corpus")
+	fs.StringVar(&o.words.cache, "book-cache", "", "directory to cache the books generated from words corpora in")
+	fs.StringVar(&o.msgTypes, "msgtypes", "m.text", "comma separated message types to read from a matrix corpus")
+	fs.StringVar(&o.senders, "senders", "", "comma separated user IDs to read the messages of from a matrix corpus, defaults to everyone")
+	fs.StringVar(&o.extensions, "extensions", ".go", "comma separated extensions of the files to read from a code corpus")
+	fs.BoolVar(&o.code.stripComments, "strip-comments", false, "leave comments out of a code corpus")
+	fs.BoolVar(&o.code.stripStrings, "strip-strings", false, "leave the contents of string literals out of a code corpus")
+	fs.StringVar(&o.code.indent, "indent", "none", "indentation of a code corpus, none to drop it, tab to type one tab per indented line or keep")
+	fs.StringVar(&o.format, "format", "text", "output format, text or json")
+}
+
+// registerProfile adds the -profile and -objective flags for the commands that
+// score layouts.
+func (o *options) registerProfile(fs *flag.FlagSet) {
+	fs.StringVar(&o.profile, "profile", "default", "scoring weights, one of "+strings.Join(keyboard.Profiles(), ", ")+" or the path to a JSON profile")
+	fs.StringVar(&o.objective, "objective", objectiveNGrams, "how layouts are scored, ngrams for the fast n-gram estimate or exact to walk the book")
+}
+
+// loadProfile sets keyboard.ScoreProfile.
+func (o *options) loadProfile() error {
+	p, err := keyboard.BundledProfile(o.profile)
+	if nil != err {
+		p, err = keyboard.LoadProfile(o.profile)
+		if nil != err {
+			return fmt.Errorf("unable to load profile %v: %w", o.profile, err)
+		}
+	}
+	keyboard.ScoreProfile = p
+	return nil
+}
+
+// validate checks the shared flags. Commands that can write formats other
+// than text and json pass them as extra.
+func (o *options) validate(extra ...string) error {
+	switch o.objective {
+	case "", objectiveExact, objectiveNGrams:
+	default:
+		return fmt.Errorf("unknown objective %v", o.objective)
+	}
+	switch o.format {
+	case "text", "json":
+		return nil
+	}
+	for _, format := range extra {
+		if o.format == format {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown format %v", o.format)
+}
+
+func (o *options) loadGeometry() (*keyboard.Geometry, error) {
+	if o.geometry == "" {
+		return keyboard.DefaultGeometry(), nil
+	}
+	g, err := keyboard.LoadGeometry(o.geometry)
+	if nil != err {
+		return nil, fmt.Errorf("unable to load geometry: %w", err)
+	}
+	return g, nil
+}
+
+// corpusSource is one of the sources the corpus is blended from.
+type corpusSource struct {
+	kind, path string
+	weight     float64
+}
+
+// sources parses the -corpus flag. Sources without a weight weigh 1.
+func (o *options) sources() ([]corpusSource, error) {
+	sources := []corpusSource{}
+	for _, spec := range strings.Split(o.corpus, ",") {
+		s := corpusSource{kind: "text", path: spec, weight: 1}
+		if i := strings.LastIndex(s.path, "="); i >= 0 {
+			w, err := strconv.ParseFloat(s.path[i+1:], 64)
+			if nil != err || w <= 0 {
+				return nil, fmt.Errorf("corpus source %v: the weight must be a positive number", spec)
+			}
+			s.path, s.weight = s.path[:i], w
+		}
+		if i := strings.Index(s.path, ":"); i >= 0 {
+			s.kind, s.path = s.path[:i], s.path[i+1:]
+		}
+		sources = append(sources, s)
+	}
+	return sources, nil
+}
+
+// loadBook reads the text of a corpus source. A text source is used as is, a
+// words source is a word frequency list that a book is generated from and a
+// matrix source is a Matrix room export whose messages make up the book. A code
+// source is a directory of source files.
+func (o *options) loadBook(s corpusSource) (string, error) {
+	kind, path := s.kind, s.path
+	switch kind {
+	case "text":
+		return createMessagesBook(path)
+	case "words":
+		if err := o.words.validate(); nil != err {
+			return "", err
+		}
+		return createWordsBook(path, o.words)
+	case "matrix":
+		f := matrixFilter{msgTypes: strings.Split(o.msgTypes, ",")}
+		if o.senders != "" {
+			f.senders = strings.Split(o.senders, ",")
+		}
+		return createMatrixBook(path, f)
+	case "code":
+		f := o.code
+		for _, ext := range strings.Split(o.extensions, ",") {
+			if !strings.HasPrefix(ext, ".") {
+				ext = "." + ext
+			}
+			f.extensions = append(f.extensions, ext)
+		}
+		if err := f.validate(); nil != err {
+			return "", err
+		}
+		return createCodeBook(path, f)
+	}
+	return "", fmt.Errorf("unknown corpus kind %v", kind)
+}
+
+// loadCorpus reads the corpus, blending its sources by their weights, and
+// selects keyboard.Chars for the free keys of g.
+func (o *options) loadCorpus(g *keyboard.Geometry) (*keyboard.Corpus, error) {
+	sources, err := o.sources()
+	if nil != err {
+		return nil, err
+	}
+	if o.objective == objectiveExact && len(sources) > 1 {
+		return nil, fmt.Errorf("a blended corpus has no book to walk, score it with -objective %v", objectiveNGrams)
+	}
+	corpora := make([]*keyboard.Corpus, len(sources))
+	weights := make([]float64, len(sources))
+	for i, s := range sources {
+		book, err := o.loadBook(s)
+		if nil != err {
+			return nil, err
+		}
+		corpora[i], err = keyboard.NewCorpus(book)
+		if nil != err {
+			return nil, fmt.Errorf("unable to compile corpus %v: %w", s.path, err)
+		}
+		weights[i] = s.weight
+		o.book = book
+	}
+	corpus := corpora[0]
+	if len(corpora) > 1 {
+		corpus, err = keyboard.BlendCorpora(corpora, weights)
+		if nil != err {
+			return nil, fmt.Errorf("unable to blend corpora: %w", err)
+		}
+	}
+	if err := selectChars(corpus, g.FreeKeys()); nil != err {
+		return nil, err
+	}
+	return corpus, nil
+}
+
+// scorer returns a scorer for the -objective flag. loadCorpus must have been
+// called.
+func (o *options) scorer() *scorer {
+	if o.objective == objectiveExact {
+		return &scorer{book: &o.book}
+	}
+	return &scorer{}
+}
@@ -24,12 +24,39 @@ func (s WordList) Len() int {
 func (s WordList) Swap(i, j int) {
 	s[i], s[j] = s[j], s[i]
 }
+
+// Less orders the most frequent words first, and words as frequent as each
+// other alphabetically, so that a list sorts the same however it was read.
 func (s WordList) Less(i, j int) bool {
-	return s[i].count > s[j].count
+	if s[i].count != s[j].count {
+		return s[i].count > s[j].count
+	}
+	return s[i].word < s[j].word
+}
+
+// wordFilter picks the words of a word list. Words counted fewer than
+// minCount times are dropped, and so are words with a character outside
+// alphabet, or when alphabet is empty, with a digit or a symbol that is
+// rarely typed in prose.
+type wordFilter struct {
+	minCount int64
+	alphabet string
 }
 
-func Parse() ([]Word, error) {
-	file, err := os.Open("simple.txt")
+func (f wordFilter) allows(word string) bool {
+	if f.alphabet == "" {
+		return !strings.ContainsAny(word, "0123456789&=`@()_:!{}></\\$*#][")
+	}
+	for _, r := range word {
+		if !strings.ContainsRune(f.alphabet, r) {
+			return false
+		}
+	}
+	return true
+}
+
+func Parse(path string, f wordFilter) ([]Word, error) {
+	file, err := os.Open(path)
 	if err != nil {
 		return nil, err
 	}
@@ -41,6 +68,9 @@ func Parse() ([]Word, error) {
 	for scanner.Scan() {
 		line := scanner.Text()
 		parts := strings.Fields(line)
+		if len(parts) < 2 {
+			continue
+		}
 		word, countStr := parts[0], parts[1]
 		count, err := strconv.ParseInt(countStr, 10, 64)
 		if nil != err {
@@ -48,10 +78,10 @@ func Parse() ([]Word, error) {
 		}
 		lo := strings.ToLower(word)
 		li := strconv.QuoteToASCII(lo)
-		if strings.ContainsAny(li, "0123456789&=`@()_:!{}></\\$*#][") {
+		l := li[1 : len(li)-1]
+		if !f.allows(l) {
 			continue
 		}
-		l := li[1 : len(li)-1]
 		if len(l) == 1 && (l != "a" && l != "i" && l != "-" && l != ":" && l != ";" && l != "!" && l != "," && l != "?" && l != ".") {
 			continue
 		}
@@ -72,27 +102,27 @@ func Parse() ([]Word, error) {
 
 	unsorted := make([]Word, 0)
 
-	var total float64
+	var total int64
 
 	for word, count := range words {
-		if count < 5000 {
+		if count < f.minCount {
 			continue
 		}
-		total += float64(count)
+		total += count
 		unsorted = append(unsorted, Word{
 			word:  word,
 			count: count,
 		})
 	}
 
-	sort.Sort(WordList(unsorted))
+	sort.SliceStable(unsorted, WordList(unsorted).Less)
 
 	sorted := make([]Word, 0)
 
 	var last float64
 	for _, word := range unsorted {
 
-		word.percentage = float64(word.count) / total
+		word.percentage = float64(word.count) / float64(total)
 		word.cumulativePercentage = word.percentage + last
 		last = word.cumulativePercentage
 		sorted = append(sorted, word)
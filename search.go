@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	prand "math/rand"
+	"sync/atomic"
+
+	"gitlab.com/meutraa/keyboard-gen/keyboard"
+)
+
+// search is shared by all the workers of a run.
+type search struct {
+	// evaluations counts the layouts scored by all workers and must be
+	// accessed atomically. It is first to keep it 64-bit aligned.
+	evaluations int64
+	ctx         context.Context
+	corpus      *keyboard.Corpus
+	geometry    *keyboard.Geometry
+	// scorer returns a scorer for a worker.
+	scorer   func() *scorer
+	results  chan keyboard.Keyboard
+	progress chan workerState
+	// maxEvaluations is split evenly between workers, so that each worker's
+	// share, and with it the result of a seeded run, does not depend on
+	// scheduling. Zero means no limit.
+	maxEvaluations int
+	workers        int
+}
+
+func (s *search) newKeyboard(sc *scorer, r *prand.Rand) *keyboard.Keyboard {
+	kb := keyboard.New(s.geometry, r)
+	kb.Corpus = s.corpus
+	sc.score(kb)
+	return kb
+}
+
+// evaluated records that a worker scored a layout.
+func (s *search) evaluated() {
+	atomic.AddInt64(&s.evaluations, 1)
+}
+
+// done reports whether a worker that has scored total layouts should stop.
+func (s *search) done(thread, total int) bool {
+	if s.maxEvaluations > 0 {
+		budget := s.maxEvaluations / s.workers
+		if thread < s.maxEvaluations%s.workers {
+			budget++
+		}
+		if total >= budget {
+			return true
+		}
+	}
+	select {
+	case <-s.ctx.Done():
+		return true
+	default:
+		return false
+	}
+}
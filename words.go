@@ -0,0 +1,84 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	prand "math/rand"
+	"os"
+	"path/filepath"
+)
+
+// wordsConfig controls the book generated from a word list. The book is
+// generated from seed, so it only changes with the word list and the
+// settings. With a cache directory, the book is written there and read back
+// by later runs instead of being generated again.
+type wordsConfig struct {
+	filter      wordFilter
+	length      int
+	punctuation string
+	seed        int64
+	cache       string
+}
+
+func (c wordsConfig) validate() error {
+	switch c.punctuation {
+	case punctuationNone, punctuationList, punctuationSentences:
+	default:
+		return fmt.Errorf("unknown punctuation model %v", c.punctuation)
+	}
+	if c.length < 1 {
+		return fmt.Errorf("book length must be at least 1")
+	}
+	return nil
+}
+
+// createWordsBook generates a book of c.length words sampled from the word
+// list at path by their frequency.
+func createWordsBook(path string, c wordsConfig) (string, error) {
+	list, err := ioutil.ReadFile(path)
+	if nil != err {
+		return "", fmt.Errorf("unable to open %v: %w", path, err)
+	}
+	cached := ""
+	if c.cache != "" {
+		key := sha256.Sum256([]byte(fmt.Sprintf("%x %d %q %d %v %d", sha256.Sum256(list), c.filter.minCount, c.filter.alphabet, c.length, c.punctuation, c.seed)))
+		cached = filepath.Join(c.cache, fmt.Sprintf("words-%x.txt", key[:8]))
+		if book, err := ioutil.ReadFile(cached); nil == err {
+			return string(book), nil
+		}
+	}
+
+	words, err := Parse(path, c.filter)
+	if nil != err {
+		return "", fmt.Errorf("unable to parse %v: %w", path, err)
+	}
+	// A word never follows itself, so one word cannot make a book.
+	if len(words) < 2 {
+		return "", fmt.Errorf("%v has %d words to build a book from, want at least 2", path, len(words))
+	}
+	book := createBook(prand.New(prand.NewSource(c.seed)), words, c.length, false, c.punctuation)
+
+	if cached != "" {
+		if err := os.MkdirAll(c.cache, 0755); nil != err {
+			return "", err
+		}
+		tmp, err := ioutil.TempFile(c.cache, filepath.Base(cached)+".*")
+		if nil != err {
+			return "", err
+		}
+		if _, err := tmp.WriteString(book); nil != err {
+			tmp.Close()
+			os.Remove(tmp.Name())
+			return "", err
+		}
+		if err := tmp.Close(); nil != err {
+			os.Remove(tmp.Name())
+			return "", err
+		}
+		if err := os.Rename(tmp.Name(), cached); nil != err {
+			return "", err
+		}
+	}
+	return book, nil
+}